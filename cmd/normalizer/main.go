@@ -2,13 +2,15 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 
-	"github.com/nicholaskarlson/proof-first-normalizer/internal/normalizer"
+	"github.com/nicholaskarlson/proof-first-normalizer/pkg/normalizer"
 )
 
 var version = "dev"
@@ -21,7 +23,7 @@ func main() {
 
 	switch os.Args[1] {
 	case "version", "--version", "-v":
-		fmt.Printf("proof-first-normalizer %s\n", version)
+		fmt.Printf("proof-first-normalizer %s (tzdata %s)\n", version, normalizer.TZDataVersion())
 		return
 
 	case "help", "-h", "--help":
@@ -34,6 +36,9 @@ func main() {
 	case "normalize":
 		cmdNormalize(os.Args[2:])
 
+	case "sniff":
+		cmdSniff(os.Args[2:])
+
 	case "demo":
 		cmdDemo(os.Args[2:])
 
@@ -50,6 +55,7 @@ func cmdValidate(args []string) {
 	in := fs.String("in", "", "input CSV path")
 	schema := fs.String("schema", "", "schema JSON path")
 	label := fs.String("label", "", "stable label for report/logging")
+	rf := addRunFlags(fs)
 	_ = fs.Parse(args)
 
 	if *in == "" || *schema == "" {
@@ -57,17 +63,24 @@ func cmdValidate(args []string) {
 		os.Exit(2)
 	}
 
-	res, errs, err := normalizer.ValidateCSV(*in, *schema, *label)
+	opt := normalizer.Options{Label: *label, Schema: *schema, Input: *in}
+	if err := rf.apply(&opt); err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(2)
+	}
+
+	res, errs, err := normalizer.ValidateCSV(*in, *schema, opt)
 	if err != nil {
 		fmt.Println("ERROR:", err)
 		os.Exit(2)
 	}
 
-	if len(errs) == 0 {
+	if len(errs) == 0 && res.ControlMismatches == 0 {
 		fmt.Printf("OK: %d rows, %d cols\n", res.RowsTotal, res.Cols)
 		os.Exit(0)
 	}
-	fmt.Printf("FAIL: %d row(s) with errors\n", res.RowsError)
+	fmt.Printf("FAIL: %d row(s) with errors, %d control total mismatch(es)\n", res.RowsError, res.ControlMismatches)
+	printTopCodes(res.ErrorsByCode)
 	os.Exit(1)
 }
 
@@ -77,6 +90,7 @@ func cmdNormalize(args []string) {
 	schema := fs.String("schema", "", "schema JSON path")
 	out := fs.String("out", "", "output directory")
 	label := fs.String("label", "", "stable label recorded in report.json")
+	rf := addRunFlags(fs)
 	_ = fs.Parse(args)
 
 	if *in == "" || *schema == "" || *out == "" {
@@ -91,6 +105,10 @@ func cmdNormalize(args []string) {
 		Schema:  *schema,
 		Input:   *in,
 	}
+	if err := rf.apply(&opt); err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(2)
+	}
 
 	res, err := normalizer.NormalizeCSV(*in, *schema, *out, opt)
 	if err != nil {
@@ -98,13 +116,77 @@ func cmdNormalize(args []string) {
 		os.Exit(2)
 	}
 
-	fmt.Printf("Wrote: %s (ok=%d, errors=%d)\n", *out, res.RowsOK, res.RowsError)
-	if res.RowsError > 0 {
+	if res.RowsDuplicate > 0 {
+		fmt.Printf("Wrote: %s (ok=%d, errors=%d, duplicates=%d)\n", *out, res.RowsOK, res.RowsError, res.RowsDuplicate)
+	} else {
+		fmt.Printf("Wrote: %s (ok=%d, errors=%d)\n", *out, res.RowsOK, res.RowsError)
+	}
+	printTopCodes(res.ErrorsByCode)
+	if res.ControlMismatches > 0 {
+		fmt.Printf("FLAGGED: %d control total mismatch(es), see report.json\n", res.ControlMismatches)
+	}
+	if res.RowsError > 0 || res.ControlMismatches > 0 {
 		os.Exit(1)
 	}
 	os.Exit(0)
 }
 
+// printTopCodes prints the most frequent error codes, most frequent first.
+func printTopCodes(codes []normalizer.CodeCount) {
+	const top = 5
+	if len(codes) == 0 {
+		return
+	}
+	sorted := append([]normalizer.CodeCount(nil), codes...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Count > sorted[j].Count })
+	if len(sorted) > top {
+		sorted = sorted[:top]
+	}
+	parts := make([]string, len(sorted))
+	for i, c := range sorted {
+		parts[i] = fmt.Sprintf("%s=%d", c.Code, c.Count)
+	}
+	fmt.Println("Top error codes:", strings.Join(parts, ", "))
+}
+
+func cmdSniff(args []string) {
+	fs := flag.NewFlagSet("sniff", flag.ContinueOnError)
+	in := fs.String("in", "", "input file path")
+	n := fs.Int("bytes", normalizer.DefaultSniffBytes, "number of leading bytes to inspect")
+	_ = fs.Parse(args)
+
+	if *in == "" {
+		fmt.Println("sniff: --in is required")
+		os.Exit(2)
+	}
+
+	b, err := sniffFile(*in, *n)
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(2)
+	}
+	os.Stdout.Write(b)
+}
+
+// sniffFile returns the Sniff report for path as indented JSON.
+func sniffFile(path string, n int) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rep, err := normalizer.Sniff(f, n)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.MarshalIndent(rep, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
 func cmdDemo(args []string) {
 	fs := flag.NewFlagSet("demo", flag.ContinueOnError)
 	outRoot := fs.String("out", "", "output root directory")
@@ -157,6 +239,22 @@ func cmdDemo(args []string) {
 
 		_ = os.RemoveAll(outDir)
 
+		// Optional: fixtures/expected/<case>/sniff.json pins the sniff report.
+		if wantSniff, errRead := os.ReadFile(filepath.Join(expDir, "sniff.json")); errRead == nil {
+			gotSniff, err := sniffFile(inCSV, normalizer.DefaultSniffBytes)
+			if err != nil {
+				fmt.Printf("ERROR: %s: %v\n", c, err)
+				os.Exit(2)
+			}
+			if !bytes.Equal(gotSniff, wantSniff) {
+				fmt.Printf("MISMATCH: %s (sniff.json)\n", c)
+				os.Exit(1)
+			}
+		} else if !os.IsNotExist(errRead) {
+			fmt.Printf("ERROR: %s: %v\n", c, errRead)
+			os.Exit(2)
+		}
+
 		wantErrPath := filepath.Join(expDir, "error.txt")
 		if wantErr, errRead := os.ReadFile(wantErrPath); errRead == nil {
 			// Expected-fail case: NormalizeCSV must return an error matching fixtures/expected/<case>/error.txt byte-for-byte.
@@ -189,8 +287,12 @@ func cmdDemo(args []string) {
 			os.Exit(2)
 		}
 
-		// Compare outputs byte-for-byte.
-		for _, name := range []string{"normalized.csv", "errors.csv", "report.json"} {
+		// Compare outputs byte-for-byte (duplicates.csv only exists with dedupe).
+		names := []string{"normalized.csv", "errors.csv", "report.json"}
+		if _, err := os.Stat(filepath.Join(outDir, "duplicates.csv")); err == nil {
+			names = append(names, "duplicates.csv")
+		}
+		for _, name := range names {
 			exp := filepath.Join(expDir, name)
 			got := filepath.Join(outDir, name)
 			eq, err := filesEqual(exp, got)
@@ -209,6 +311,103 @@ func cmdDemo(args []string) {
 	os.Exit(0)
 }
 
+// runFlags are the flags shared by normalize and validate that override
+// the schema for one run. Flags that are not given keep the schema's setting.
+type runFlags struct {
+	fs         *flag.FlagSet
+	encoding   *string
+	delimiter  *string
+	quoting    *string
+	comment    *string
+	lazyQuotes *bool
+	expectRows *int
+	expectSums sumFlags
+	keyMemMB   *int
+	sortMemMB  *int
+	tempDir    *string
+}
+
+func addRunFlags(fs *flag.FlagSet) *runFlags {
+	f := &runFlags{
+		fs:         fs,
+		encoding:   fs.String("encoding", "", "input encoding (overrides the schema's; default utf-8)"),
+		delimiter:  fs.String("delimiter", "", `input field delimiter (one character; "tab" or \t for TSV)`),
+		quoting:    fs.String("quoting", "", `input quoting: "standard" or "none"`),
+		comment:    fs.String("comment", "", "skip input lines starting with this character"),
+		lazyQuotes: fs.Bool("lazy-quotes", false, "tolerate stray quotes in input fields"),
+		expectRows: fs.Int("expect-rows", 0, "control total: expected number of data rows"),
+		keyMemMB:   fs.Int("key-memory-mb", normalizer.DefaultKeyMemory>>20, "memory per key, dedupe or distinct-value index before spilling to disk"),
+		sortMemMB:  fs.Int("sort-memory-mb", normalizer.DefaultSortMemory>>20, "memory for sorting rows (schema sort_by) before spilling to disk"),
+		tempDir:    fs.String("temp-dir", "", "directory for spill files (default: system temp dir)"),
+	}
+	fs.Var(&f.expectSums, "expect-sum", "control total: expected sum as column=value (repeatable); exact input values over every data row")
+	return f
+}
+
+// apply sets the Options fields for the flags that were given. The schema
+// at opt.Schema is read for the dialect the flags modify.
+func (f *runFlags) apply(opt *normalizer.Options) error {
+	set := map[string]bool{}
+	f.fs.Visit(func(fl *flag.Flag) { set[fl.Name] = true })
+
+	opt.Encoding = *f.encoding
+	opt.KeyMemory = *f.keyMemMB << 20
+	opt.SortMemory = *f.sortMemMB << 20
+	opt.TempDir = *f.tempDir
+	if set["expect-rows"] {
+		opt.ExpectRows = f.expectRows
+	}
+	if len(f.expectSums) > 0 {
+		opt.ExpectSums = map[string]string(f.expectSums)
+	}
+	if !set["delimiter"] && !set["quoting"] && !set["comment"] && !set["lazy-quotes"] {
+		return nil
+	}
+
+	schema, _, err := normalizer.LoadSchema(opt.Schema)
+	if err != nil {
+		return err
+	}
+	var d normalizer.Dialect
+	if schema.Dialect != nil {
+		d = *schema.Dialect
+	}
+	if set["delimiter"] {
+		d.Delimiter = *f.delimiter
+		if d.Delimiter == "tab" || d.Delimiter == `\t` {
+			d.Delimiter = "\t"
+		}
+	}
+	if set["quoting"] {
+		d.Quoting = *f.quoting
+	}
+	if set["comment"] {
+		d.Comment = *f.comment
+	}
+	if set["lazy-quotes"] {
+		d.LazyQuotes = *f.lazyQuotes
+	}
+	opt.Dialect = &d
+	return nil
+}
+
+// sumFlags collects repeated --expect-sum column=value flags.
+type sumFlags map[string]string
+
+func (s *sumFlags) String() string { return "" }
+
+func (s *sumFlags) Set(v string) error {
+	col, val, ok := strings.Cut(v, "=")
+	if !ok || col == "" || val == "" {
+		return fmt.Errorf("want column=value, got %q", v)
+	}
+	if *s == nil {
+		*s = sumFlags{}
+	}
+	(*s)[col] = val
+	return nil
+}
+
 func filesEqual(a, b string) (bool, error) {
 	ab, err := os.ReadFile(a)
 	if err != nil {
@@ -244,12 +443,27 @@ func usage() {
 	fmt.Println("proof-first-normalizer")
 	fmt.Println()
 	fmt.Println("Commands (v0.1.0):")
-	fmt.Println("  normalizer normalize --in <raw.csv> --schema <schema.json> --out <dir> [--label <string>]")
-	fmt.Println("  normalizer validate  --in <raw.csv> --schema <schema.json> [--label <string>]")
+	fmt.Println("  normalizer normalize --in <raw.csv> --schema <schema.json> --out <dir> [--label <string>] [--encoding <name>] [dialect flags] [control totals]")
+	fmt.Println("  normalizer validate  --in <raw.csv> --schema <schema.json> [--label <string>] [--encoding <name>] [dialect flags] [control totals]")
+	fmt.Println("  normalizer sniff     --in <file> [--bytes <n>]")
 	fmt.Println("  normalizer demo      --out <dir>")
 	fmt.Println("  normalizer version   (--version, -v)")
 
+	fmt.Println()
+	fmt.Println("Encodings: utf-8 (default), windows-1252, iso-8859-1, utf-16 (BOM required), utf-16le, utf-16be")
+	fmt.Println()
+	fmt.Println("Dialect flags (override the schema's dialect block):")
+	fmt.Println("  --delimiter <char|tab>  --quoting standard|none  --comment <char>  --lazy-quotes")
+	fmt.Println()
+	fmt.Println("Control totals (override the schema's trailer values):")
+	fmt.Println("  --expect-rows <n>  --expect-sum <column>=<value> (repeatable)")
+	fmt.Println()
+	fmt.Println("Resources:")
+	fmt.Println("  --key-memory-mb <n>  --sort-memory-mb <n>  --temp-dir <dir>")
 	fmt.Println()
 	fmt.Println("Demo:")
 	fmt.Println("  Scans fixtures/input/* (sorted) and verifies outputs match fixtures/expected/*.")
+	fmt.Println()
+	fmt.Println("Sniff:")
+	fmt.Println("  Prints detected encoding, BOM, line endings, delimiter, quoting, header and column count as JSON.")
 }
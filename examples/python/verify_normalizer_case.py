@@ -90,6 +90,8 @@ def main() -> None:
     schema = load_json(schema_p)
     want_cols = [c["name"] for c in schema.get("columns", [])]
     assert want_cols, "schema has no columns"
+    # extra_columns=passthrough appends the extra input columns after the schema columns.
+    want_cols += (report.get("header") or {}).get("passthrough", [])
 
     with norm_p.open(newline="", encoding="utf-8") as f:
         r = csv.reader(f)
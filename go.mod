@@ -1,3 +1,5 @@
 module github.com/nicholaskarlson/proof-first-normalizer
 
 go 1.22
+
+require golang.org/x/text v0.22.0
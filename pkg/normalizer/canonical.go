@@ -0,0 +1,110 @@
+package normalizer
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"errors"
+	"hash"
+	"io"
+	"unicode/utf8"
+)
+
+var errInvalidUTF8 = errors.New("input is not valid UTF-8")
+
+// canonicalReader streams the input canonicalization rules:
+//   - strip a leading UTF-8 BOM
+//   - normalize CRLF/CR -> LF
+//   - reject invalid UTF-8
+//
+// Every byte it emits is also fed to a SHA-256 hash, so the input digest
+// comes out of the same pass that parses the CSV.
+type canonicalReader struct {
+	src     *bufio.Reader
+	sum     hash.Hash
+	buf     []byte
+	out     []byte // canonical bytes not yet handed to the caller
+	pending []byte // trailing bytes of an incomplete UTF-8 sequence
+	started bool   // BOM check done
+	lastCR  bool   // previous input byte was '\r'
+	err     error
+}
+
+func newCanonicalReader(r io.Reader) *canonicalReader {
+	return &canonicalReader{
+		src: bufio.NewReaderSize(r, 64*1024),
+		sum: sha256.New(),
+		buf: make([]byte, 32*1024),
+	}
+}
+
+func (c *canonicalReader) Read(p []byte) (int, error) {
+	for len(c.out) == 0 {
+		if c.err != nil {
+			return 0, c.err
+		}
+		c.fill()
+	}
+	n := copy(p, c.out)
+	c.out = c.out[n:]
+	return n, nil
+}
+
+// Sum returns the hex SHA-256 of all canonical bytes emitted so far.
+func (c *canonicalReader) Sum() string {
+	return hexSum(c.sum)
+}
+
+func (c *canonicalReader) fill() {
+	if !c.started {
+		c.started = true
+		if b, _ := c.src.Peek(3); len(b) == 3 && b[0] == 0xEF && b[1] == 0xBB && b[2] == 0xBF {
+			_, _ = c.src.Discard(3)
+		}
+	}
+
+	n, err := c.src.Read(c.buf)
+	chunk := make([]byte, 0, len(c.pending)+n)
+	chunk = append(chunk, c.pending...)
+	for _, b := range c.buf[:n] {
+		if c.lastCR {
+			c.lastCR = false
+			if b == '\n' {
+				continue
+			}
+		}
+		if b == '\r' {
+			c.lastCR = true
+			b = '\n'
+		}
+		chunk = append(chunk, b)
+	}
+
+	cut := len(chunk)
+	if err == nil {
+		cut = utf8Cut(chunk)
+	}
+	if !utf8.Valid(chunk[:cut]) {
+		c.err = errInvalidUTF8
+		return
+	}
+	c.pending = append([]byte(nil), chunk[cut:]...)
+	c.out = chunk[:cut]
+	c.sum.Write(c.out)
+	if err != nil {
+		c.err = err
+	}
+}
+
+// utf8Cut returns the length of the prefix of b that ends on a rune
+// boundary, leaving a trailing incomplete sequence for the next chunk.
+func utf8Cut(b []byte) int {
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if utf8.FullRune(b[i:]) {
+				return len(b)
+			}
+			return i
+		}
+	}
+	return len(b)
+}
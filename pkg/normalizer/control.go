@@ -0,0 +1,241 @@
+package normalizer
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Control-total mismatch policies (ControlTotals.OnMismatch).
+const (
+	MismatchFail = "fail" // a mismatch fails the run; no outputs are written (default)
+	MismatchFlag = "flag" // mismatches are reported as ERR_CONTROL_TOTAL in report.json
+)
+
+// ControlTotals declares totals the input must reconcile with, read from
+// named capture groups of the trailer pattern. Options.ExpectRows and
+// Options.ExpectSums supply them directly instead.
+type ControlTotals struct {
+	Rows       string       `json:"rows,omitempty"` // trailer group holding the data row count
+	Sums       []ControlSum `json:"sums,omitempty"`
+	OnMismatch string       `json:"on_mismatch,omitempty"`
+}
+
+// ControlSum is the expected exact sum of a decimal column.
+type ControlSum struct {
+	Column string `json:"column"`
+	Group  string `json:"group"` // trailer group holding the sum
+}
+
+func (s *Schema) validateControlTotals() error {
+	ct := s.ControlTotals
+	if ct == nil {
+		return nil
+	}
+	switch ct.OnMismatch {
+	case "", MismatchFail, MismatchFlag:
+	default:
+		return fmt.Errorf("schema: control_totals: invalid on_mismatch %q", ct.OnMismatch)
+	}
+
+	var groups []string
+	if s.Trailer != nil {
+		groups = regexp.MustCompile(anchorPattern(s.Trailer.Pattern)).SubexpNames()
+	}
+	hasGroup := func(g string) bool {
+		for _, name := range groups {
+			if name != "" && name == g {
+				return true
+			}
+		}
+		return false
+	}
+	if ct.Rows != "" && !hasGroup(ct.Rows) {
+		return fmt.Errorf("schema: control_totals: rows: trailer pattern has no group %q", ct.Rows)
+	}
+	seen := map[string]bool{}
+	for _, cs := range ct.Sums {
+		if err := s.checkSumColumn(cs.Column); err != nil {
+			return fmt.Errorf("schema: control_totals: %w", err)
+		}
+		if seen[cs.Column] {
+			return fmt.Errorf("schema: control_totals: duplicate sum for column %q", cs.Column)
+		}
+		seen[cs.Column] = true
+		if !hasGroup(cs.Group) {
+			return fmt.Errorf("schema: control_totals: sum(%s): trailer pattern has no group %q", cs.Column, cs.Group)
+		}
+	}
+	return nil
+}
+
+func (s *Schema) checkSumColumn(name string) error {
+	for _, c := range s.Columns {
+		if c.Name == name {
+			if c.Type != "decimal" {
+				return fmt.Errorf("sum(%s): column is not a decimal", name)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("sum(%s): no such column", name)
+}
+
+// controlSums holds, per decimal column, the exact sum of the values as
+// parsed from the input (before rounding to the column's scale) over every
+// data row, like the rows check: a trailer describes the file as sent, so
+// rejected and deduped rows count too. Values that are not decimals (already
+// row errors) and rows with the wrong number of fields add nothing. It is
+// kept apart from the column statistics, which describe normalized.csv.
+type controlSums []*decimal // nil for non-decimal columns
+
+func newControlSums(cols []column) controlSums {
+	cs := make(controlSums, len(cols))
+	for i := range cols {
+		if cols[i].Type == "decimal" {
+			cs[i] = &decimal{unscaled: new(big.Int), scale: cols[i].scale()}
+		}
+	}
+	return cs
+}
+
+// add adds the raw, trimmed value of column i if it is a decimal.
+func (cs controlSums) add(i int, raw string) {
+	if cs[i] == nil {
+		return
+	}
+	if d, ok := parseDecimal(raw); ok {
+		*cs[i] = cs[i].add(d)
+	}
+}
+
+// controlCheck is one total to reconcile; expected is filled in from the
+// trailer after the scan unless it came from Options.
+type controlCheck struct {
+	ControlTotalReport
+	col   int    // sums: schema column index
+	group string // trailer group, if expected comes from the trailer
+}
+
+// controlPlan lists the checks for a run in a fixed order: rows first,
+// then sums in schema column order.
+func controlPlan(schema *Schema, opt Options) ([]controlCheck, error) {
+	ct := schema.ControlTotals
+	if ct == nil {
+		ct = &ControlTotals{}
+	}
+	var checks []controlCheck
+	switch {
+	case opt.ExpectRows != nil:
+		checks = append(checks, controlCheck{ControlTotalReport: ControlTotalReport{
+			Check: "rows", Source: "option", Expected: strconv.Itoa(*opt.ExpectRows),
+		}})
+	case ct.Rows != "":
+		checks = append(checks, controlCheck{ControlTotalReport: ControlTotalReport{
+			Check: "rows", Source: "trailer",
+		}, group: ct.Rows})
+	}
+
+	for col := range opt.ExpectSums {
+		if err := schema.checkSumColumn(col); err != nil {
+			return nil, fmt.Errorf("control totals: %w", err)
+		}
+	}
+	for i, c := range schema.Columns {
+		chk := controlCheck{ControlTotalReport: ControlTotalReport{Check: "sum", Column: c.Name}, col: i}
+		if v, ok := opt.ExpectSums[c.Name]; ok {
+			chk.Source, chk.Expected = "option", strings.TrimSpace(v)
+			checks = append(checks, chk)
+			continue
+		}
+		for _, cs := range ct.Sums {
+			if cs.Column == c.Name {
+				chk.Source, chk.group = "trailer", cs.Group
+				checks = append(checks, chk)
+			}
+		}
+	}
+	return checks, nil
+}
+
+// reconcile compares the checks with what the scan found. It returns the
+// report entries and the first mismatch as an error (nil if all agree).
+func reconcile(checks []controlCheck, schema *Schema, scan scanResult) ([]ControlTotalReport, error) {
+	if len(checks) == 0 {
+		return nil, nil
+	}
+	var trailerRE *regexp.Regexp
+	if schema.Trailer != nil {
+		trailerRE = regexp.MustCompile(anchorPattern(schema.Trailer.Pattern))
+	}
+
+	var out []ControlTotalReport
+	var first error
+	for _, chk := range checks {
+		if chk.group != "" {
+			chk.Expected = trailerGroup(trailerRE, scan.trailer, chk.group)
+		}
+		name := chk.Check
+		if chk.Check == "sum" {
+			name = "sum(" + chk.Column + ")"
+		}
+
+		var agree bool
+		switch chk.Check {
+		case "rows":
+			chk.Actual = strconv.Itoa(scan.RowsTotal)
+			n, err := strconv.Atoi(chk.Expected)
+			agree = err == nil && n == scan.RowsTotal
+		case "sum":
+			sum := *scan.sums[chk.col]
+			chk.Actual = sum.String()
+			want, ok := parseDecimal(chk.Expected)
+			agree = ok && want.cmp(sum) == 0
+		}
+
+		if !agree {
+			chk.Code = "ERR_CONTROL_TOTAL"
+			if chk.group != "" && chk.Expected == "" {
+				chk.Message = fmt.Sprintf("trailer has no value for group %q", chk.group)
+			} else {
+				chk.Message = fmt.Sprintf("expected %s, got %s", chk.Expected, chk.Actual)
+			}
+			if first == nil {
+				first = fmt.Errorf("control total %s: %s", name, chk.Message)
+			}
+		}
+		out = append(out, chk.ControlTotalReport)
+	}
+	return out, first
+}
+
+// trailerGroup returns the first non-empty value of the named group across
+// the trailer lines.
+func trailerGroup(re *regexp.Regexp, lines []string, group string) string {
+	if re == nil {
+		return ""
+	}
+	idx := re.SubexpIndex(group)
+	for _, line := range lines {
+		if m := re.FindStringSubmatch(line); m != nil && idx >= 0 && m[idx] != "" {
+			return strings.TrimSpace(m[idx])
+		}
+	}
+	return ""
+}
+
+func (s *Schema) flagMismatches() bool {
+	return s.ControlTotals != nil && s.ControlTotals.OnMismatch == MismatchFlag
+}
+
+func countMismatches(totals []ControlTotalReport) int {
+	n := 0
+	for _, t := range totals {
+		if t.Code != "" {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,121 @@
+package normalizer
+
+import (
+	"math/big"
+	"strings"
+)
+
+// Rounding modes for decimal columns.
+const (
+	RoundReject   = "reject"    // more digits than the scale is a row error (ERR_SCALE)
+	RoundTruncate = "truncate"  // drop extra digits (toward zero)
+	RoundHalfUp   = "half_up"   // nearest, ties away from zero
+	RoundHalfEven = "half_even" // nearest, ties to even
+	RoundFloor    = "floor"     // toward negative infinity
+	RoundCeiling  = "ceiling"   // toward positive infinity
+)
+
+var bigTen = big.NewInt(10)
+
+// decimal is an exact fixed-point value: unscaled * 10^-scale. No floats are
+// involved anywhere in parsing, rounding, comparison or formatting.
+type decimal struct {
+	unscaled *big.Int
+	scale    int
+}
+
+// parseDecimal parses an optional '-' followed by digits with at most one
+// '.', keeping every digit given.
+func parseDecimal(s string) (decimal, bool) {
+	s = strings.TrimSpace(s)
+	if !looksDecimal(s) {
+		return decimal{}, false
+	}
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	intp, frac, _ := strings.Cut(s, ".")
+	u, ok := new(big.Int).SetString(intp+frac, 10)
+	if !ok {
+		return decimal{}, false
+	}
+	if neg {
+		u.Neg(u)
+	}
+	return decimal{unscaled: u, scale: len(frac)}, true
+}
+
+// rescale returns d at the given scale. exact reports whether no digits
+// were lost; with RoundReject an inexact rescale fails (ok == false).
+func (d decimal) rescale(scale int, mode string) (out decimal, exact, ok bool) {
+	if scale >= d.scale {
+		m := new(big.Int).Exp(bigTen, big.NewInt(int64(scale-d.scale)), nil)
+		return decimal{unscaled: m.Mul(m, d.unscaled), scale: scale}, true, true
+	}
+	div := new(big.Int).Exp(bigTen, big.NewInt(int64(d.scale-scale)), nil)
+	q, r := new(big.Int).QuoRem(d.unscaled, div, new(big.Int))
+	if r.Sign() == 0 {
+		return decimal{unscaled: q, scale: scale}, true, true
+	}
+
+	// q is truncated toward zero; away moves it one unit away from zero.
+	away := false
+	switch mode {
+	case RoundReject:
+		return decimal{}, false, false
+	case RoundTruncate:
+	case RoundFloor:
+		away = r.Sign() < 0
+	case RoundCeiling:
+		away = r.Sign() > 0
+	case RoundHalfUp, RoundHalfEven:
+		twice := new(big.Int).Abs(r)
+		twice.Lsh(twice, 1)
+		switch twice.Cmp(div) {
+		case 1:
+			away = true
+		case 0:
+			away = mode == RoundHalfUp || q.Bit(0) == 1
+		}
+	}
+	if away {
+		q.Add(q, big.NewInt(int64(r.Sign())))
+	}
+	return decimal{unscaled: q, scale: scale}, false, true
+}
+
+// add returns d+e at the larger of the two scales, so no digit is lost.
+func (d decimal) add(e decimal) decimal {
+	switch {
+	case d.scale < e.scale:
+		d, _, _ = d.rescale(e.scale, RoundReject)
+	case e.scale < d.scale:
+		e, _, _ = e.rescale(d.scale, RoundReject)
+	}
+	return decimal{unscaled: new(big.Int).Add(d.unscaled, e.unscaled), scale: d.scale}
+}
+
+func (d decimal) cmp(e decimal) int {
+	switch {
+	case d.scale < e.scale:
+		d, _, _ = d.rescale(e.scale, RoundReject)
+	case e.scale < d.scale:
+		e, _, _ = e.rescale(d.scale, RoundReject)
+	}
+	return d.unscaled.Cmp(e.unscaled)
+}
+
+// String formats d with exactly d.scale fractional digits. Zero is never
+// signed.
+func (d decimal) String() string {
+	digits := new(big.Int).Abs(d.unscaled).String()
+	if d.scale > 0 {
+		if len(digits) <= d.scale {
+			digits = strings.Repeat("0", d.scale-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-d.scale] + "." + digits[len(digits)-d.scale:]
+	}
+	if d.unscaled.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
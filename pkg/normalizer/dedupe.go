@@ -0,0 +1,87 @@
+package normalizer
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Deduplication modes (Schema.Dedupe).
+const (
+	DedupeOff   = "off"   // keep every row (default)
+	DedupeExact = "exact" // drop rows whose whole normalized record was already kept
+	DedupeKey   = "key"   // drop rows whose primary key was already kept
+)
+
+func (s *Schema) validateDedupe() error {
+	switch s.Dedupe {
+	case "", DedupeOff, DedupeExact:
+	case DedupeKey:
+		if len(s.PrimaryKey) == 0 {
+			return fmt.Errorf("schema: dedupe %q requires primary_key", s.Dedupe)
+		}
+	default:
+		return fmt.Errorf("schema: invalid dedupe %q", s.Dedupe)
+	}
+	return nil
+}
+
+func (s *Schema) dedupes() bool {
+	return s.Dedupe == DedupeExact || s.Dedupe == DedupeKey
+}
+
+// deduper remembers the rows written to normalized.csv, by whole record or
+// by primary key. A row that passed per-column validation and the rules is
+// looked up before the key constraints, so an exact resend is dropped
+// rather than reported as a duplicate key; it is only recorded once it has
+// passed those too, so a rejected row is never the "first" copy.
+type deduper struct {
+	cols  []int // schema column indices of the key; nil means the whole record
+	index *keyIndex
+}
+
+func newDeduper(s *Schema, spec runSpec) *deduper {
+	if !s.dedupes() {
+		return nil
+	}
+	d := &deduper{index: newKeyIndex(spec.keyMemory, spec.tempDir)}
+	if s.Dedupe == DedupeKey {
+		for _, name := range s.PrimaryKey {
+			d.cols = append(d.cols, s.columnIndex(name))
+		}
+	}
+	return d
+}
+
+func (d *deduper) key(outRec []string) string {
+	var key []byte
+	add := func(v string) {
+		key = binary.AppendUvarint(key, uint64(len(v)))
+		key = append(key, v...)
+	}
+	if d.cols == nil {
+		for _, v := range outRec {
+			add(v)
+		}
+	} else {
+		for _, i := range d.cols {
+			add(outRec[i])
+		}
+	}
+	return string(key)
+}
+
+// lookup returns the row an equal record was written at, or 0.
+func (d *deduper) lookup(outRec []string) (int, error) {
+	return d.index.lookup(d.key(outRec))
+}
+
+// record remembers a row written to normalized.csv.
+func (d *deduper) record(outRec []string, row int) error {
+	return d.index.insert(d.key(outRec), row)
+}
+
+func (d *deduper) close() {
+	if d != nil {
+		d.index.close()
+	}
+}
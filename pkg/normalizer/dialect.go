@@ -0,0 +1,111 @@
+package normalizer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Quoting modes (Dialect.Quoting).
+const (
+	QuotingStandard = "standard" // RFC 4180 double quotes
+	QuotingNone     = "none"     // quotes are ordinary characters; one record per line
+)
+
+// Dialect describes how the input is delimited. Outputs are always standard
+// comma-separated CSV.
+type Dialect struct {
+	Delimiter  string `json:"delimiter"`   // one character (default ",")
+	Quoting    string `json:"quoting"`     // "standard" (default) or "none"
+	Comment    string `json:"comment"`     // one character starting comment lines (default none)
+	LazyQuotes bool   `json:"lazy_quotes"` // tolerate stray quotes (standard quoting only)
+}
+
+// withDefaults returns d with every unset field filled in.
+func (d Dialect) withDefaults() Dialect {
+	if d.Delimiter == "" {
+		d.Delimiter = ","
+	}
+	if d.Quoting == "" {
+		d.Quoting = QuotingStandard
+	}
+	return d
+}
+
+func (d Dialect) validate() error {
+	d = d.withDefaults()
+	delim, ok := singleRune(d.Delimiter)
+	if !ok || delim == '"' || delim == '\r' || delim == '\n' || delim == utf8.RuneError {
+		return fmt.Errorf("dialect: invalid delimiter %q", d.Delimiter)
+	}
+	switch d.Quoting {
+	case QuotingStandard, QuotingNone:
+	default:
+		return fmt.Errorf("dialect: invalid quoting %q", d.Quoting)
+	}
+	if d.Comment != "" {
+		c, ok := singleRune(d.Comment)
+		if !ok || c == delim || c == '"' || c == '\r' || c == '\n' || c == utf8.RuneError {
+			return fmt.Errorf("dialect: invalid comment %q", d.Comment)
+		}
+	}
+	if d.LazyQuotes && d.Quoting == QuotingNone {
+		return fmt.Errorf("dialect: lazy_quotes requires quoting %q", QuotingStandard)
+	}
+	return nil
+}
+
+func singleRune(s string) (rune, bool) {
+	r, n := utf8.DecodeRuneInString(s)
+	return r, n > 0 && n == len(s)
+}
+
+// recordReader yields input records; both implementations skip empty lines
+// (and comment lines) without counting them as rows.
+type recordReader interface {
+	Read() ([]string, error)
+}
+
+// newRecordReader returns a reader for the (validated) dialect d.
+func newRecordReader(r io.Reader, d Dialect) recordReader {
+	d = d.withDefaults()
+	delim, _ := singleRune(d.Delimiter)
+	var comment rune
+	if d.Comment != "" {
+		comment, _ = singleRune(d.Comment)
+	}
+	if d.Quoting == QuotingNone {
+		return &plainReader{br: bufio.NewReader(r), delim: d.Delimiter, comment: d.Comment}
+	}
+	cr := csv.NewReader(r)
+	cr.Comma = delim
+	cr.Comment = comment
+	cr.LazyQuotes = d.LazyQuotes
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	return cr
+}
+
+// plainReader splits each line on the delimiter with no quote handling.
+type plainReader struct {
+	br      *bufio.Reader
+	delim   string
+	comment string
+}
+
+func (p *plainReader) Read() ([]string, error) {
+	for {
+		line, err := p.br.ReadString('\n')
+		if line == "" && err != nil {
+			return nil, err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" || (p.comment != "" && strings.HasPrefix(line, p.comment)) {
+			continue
+		}
+		return strings.Split(line, p.delim), nil
+	}
+}
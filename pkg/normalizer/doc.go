@@ -0,0 +1,26 @@
+// Package normalizer validates and normalizes CSV files against a JSON schema,
+// producing deterministic normalized.csv, errors.csv and report.json outputs.
+//
+// # Compatibility
+//
+// The exported API of this package and the shape of report.json are
+// versioned together by ReportVersion, which every report records as
+// "report_version". While ReportVersion stays the same:
+//
+//   - exported identifiers are not removed, renamed or changed in signature;
+//   - report.json fields are not removed, renamed or retyped. New fields are
+//     added over time, so report.json bytes differ between releases and
+//     consumers must ignore keys they do not know;
+//   - errors.csv keeps its columns (row, field, code, message, value) and the
+//     existing ERR_* codes keep their meaning.
+//
+// Any change that breaks one of these rules bumps ReportVersion. Within one
+// release, the same input, schema and options produce byte-identical
+// outputs. Zone conversions use the embedded IANA time zone database
+// (TZDataVersion); refreshing it between releases can change timestamp
+// outputs and is noted in the release notes.
+package normalizer
+
+// ReportVersion is the version of the report.json format and of the
+// compatibility promise described in the package documentation.
+const ReportVersion = 1
@@ -0,0 +1,172 @@
+package normalizer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Input encodings (Schema.Encoding, Options.Encoding). Non-UTF-8 input is
+// transcoded to UTF-8 before canonicalization; nothing is auto-detected.
+const (
+	EncodingUTF8        = "utf-8" // default
+	EncodingWindows1252 = "windows-1252"
+	EncodingISO88591    = "iso-8859-1"
+	EncodingUTF16       = "utf-16" // byte order taken from a required BOM
+	EncodingUTF16LE     = "utf-16le"
+	EncodingUTF16BE     = "utf-16be"
+)
+
+func validEncoding(enc string) bool {
+	switch enc {
+	case "", EncodingUTF8, EncodingWindows1252, EncodingISO88591,
+		EncodingUTF16, EncodingUTF16LE, EncodingUTF16BE:
+		return true
+	}
+	return false
+}
+
+// encodingError reports input bytes that are invalid in the declared
+// encoding. Like invalid UTF-8, it fails the whole file.
+type encodingError struct {
+	enc    string
+	offset int64 // of the offending raw byte
+	detail string
+}
+
+func (e *encodingError) Error() string {
+	return fmt.Sprintf("input is not valid %s (%s at offset %d)", e.enc, e.detail, e.offset)
+}
+
+// isInputError reports whether err is a fatal problem with the input bytes
+// themselves, returned as is rather than wrapped as a CSV read error.
+func isInputError(err error) bool {
+	var ee *encodingError
+	return errors.Is(err, errInvalidUTF8) || errors.As(err, &ee)
+}
+
+// newDecodeReader returns r transcoded from enc to UTF-8. UTF-8 input is
+// returned unchanged; canonicalReader validates it.
+func newDecodeReader(r io.Reader, enc string) io.Reader {
+	switch enc {
+	case EncodingWindows1252:
+		return &decodeReader{src: r, enc: enc, cm: charmap.Windows1252}
+	case EncodingISO88591:
+		return &decodeReader{src: r, enc: enc, cm: charmap.ISO8859_1}
+	case EncodingUTF16, EncodingUTF16LE, EncodingUTF16BE:
+		return &decodeReader{src: r, enc: enc, wide: true, le: enc == EncodingUTF16LE}
+	}
+	return r
+}
+
+// decodeReader streams single-byte or UTF-16 input as UTF-8, failing on
+// bytes the encoding does not define instead of substituting U+FFFD.
+type decodeReader struct {
+	src  io.Reader
+	enc  string
+	cm   *charmap.Charmap // single-byte encodings
+	wide bool             // UTF-16
+	le   bool             // UTF-16 byte order, once known
+
+	buf     []byte
+	carry   []byte // UTF-16: raw bytes of an incomplete code unit or pair
+	out     []byte
+	offset  int64 // raw bytes consumed so far
+	started bool
+	err     error
+}
+
+func (d *decodeReader) Read(p []byte) (int, error) {
+	for len(d.out) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		d.fill()
+	}
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+	return n, nil
+}
+
+func (d *decodeReader) fail(off int64, detail string) {
+	d.err = &encodingError{enc: d.enc, offset: off, detail: detail}
+}
+
+func (d *decodeReader) fill() {
+	if d.buf == nil {
+		d.buf = make([]byte, 32*1024)
+	}
+	n, err := d.src.Read(d.buf)
+	chunk := d.buf[:n]
+	if d.wide {
+		d.decodeUTF16(append(d.carry, chunk...), err == io.EOF)
+	} else {
+		for i, b := range chunk {
+			r := d.cm.DecodeByte(b)
+			if r == utf8.RuneError {
+				d.fail(d.offset+int64(i), fmt.Sprintf("undefined byte 0x%02X", b))
+				return
+			}
+			d.out = utf8.AppendRune(d.out, r)
+		}
+		d.offset += int64(n)
+	}
+	if err != nil && d.err == nil {
+		d.err = err
+	}
+}
+
+// decodeUTF16 decodes b (carried bytes plus the new chunk), keeping any
+// trailing incomplete unit or surrogate pair for the next call.
+func (d *decodeReader) decodeUTF16(b []byte, eof bool) {
+	start := d.offset - int64(len(d.carry))
+	i := 0
+	if !d.started && (len(b) >= 2 || eof) {
+		d.started = true
+		switch {
+		case len(b) >= 2 && b[0] == 0xFF && b[1] == 0xFE && d.enc != EncodingUTF16BE:
+			d.le, i = true, 2
+		case len(b) >= 2 && b[0] == 0xFE && b[1] == 0xFF && d.enc != EncodingUTF16LE:
+			d.le, i = false, 2
+		case d.enc == EncodingUTF16:
+			d.fail(0, "missing byte order mark")
+			return
+		}
+	}
+	unit := func(j int) rune {
+		if d.le {
+			return rune(b[j]) | rune(b[j+1])<<8
+		}
+		return rune(b[j])<<8 | rune(b[j+1])
+	}
+	for d.started && i+2 <= len(b) {
+		r := unit(i)
+		if !utf16.IsSurrogate(r) {
+			d.out = utf8.AppendRune(d.out, r)
+			i += 2
+			continue
+		}
+		if i+4 > len(b) {
+			break
+		}
+		if r = utf16.DecodeRune(r, unit(i+2)); r == utf8.RuneError {
+			d.fail(start+int64(i), "unpaired surrogate")
+			return
+		}
+		d.out = utf8.AppendRune(d.out, r)
+		i += 4
+	}
+	d.offset = start + int64(len(b))
+	d.carry = append(d.carry[:0], b[i:]...)
+	if eof && len(d.carry) > 0 {
+		detail := "truncated code unit"
+		if len(d.carry) >= 2 {
+			detail = "unpaired surrogate"
+		}
+		d.fail(start+int64(i), detail)
+	}
+}
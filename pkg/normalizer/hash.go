@@ -3,9 +3,14 @@ package normalizer
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"hash"
 )
 
 func sha256Hex(b []byte) string {
 	sum := sha256.Sum256(b)
 	return hex.EncodeToString(sum[:])
 }
+
+func hexSum(h hash.Hash) string {
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,142 @@
+package normalizer
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Extra-column policies (Schema.ExtraColumns).
+const (
+	ExtraReject      = "reject"      // any column not in the schema fails the file (default)
+	ExtraDrop        = "drop"        // extra columns are ignored (listed in report.json)
+	ExtraPassthrough = "passthrough" // extra columns are copied after the schema columns
+)
+
+// Header matching modes (Schema.HeaderMatch).
+const (
+	HeaderExact      = "exact"      // names compared after trimming (default)
+	HeaderNormalized = "normalized" // also NFC, case-folded, inner whitespace collapsed
+)
+
+// headerKey is the form header names and schema names are compared in.
+func (s *Schema) headerKey(h string) string {
+	if s.HeaderMatch != HeaderNormalized {
+		return h
+	}
+	h = cases.Fold().String(norm.NFC.String(h))
+	return norm.NFC.String(strings.Join(strings.Fields(h), " "))
+}
+
+// headerBinding maps input header positions onto the schema.
+type headerBinding struct {
+	width       int      // number of input header fields
+	index       []int    // per schema column: input position, or -1 if absent
+	passthrough []int    // input positions appended after the schema columns
+	names       []string // normalized.csv header
+
+	missing []string // optional_in_header columns absent from the input
+	dropped []string // extra input columns ignored
+	aliases []AliasMatch
+}
+
+// bindHeader resolves the input header against the schema. Anything that
+// would make the mapping ambiguous fails the file.
+func bindHeader(header []string, schema *Schema) (*headerBinding, error) {
+	header = append([]string(nil), header...)
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+
+	hmap := make(map[string]int, len(header))
+	for i, h := range header {
+		if h == "" {
+			return nil, fmt.Errorf("header has empty column name")
+		}
+		k := schema.headerKey(h)
+		if _, ok := hmap[k]; ok {
+			return nil, fmt.Errorf("header has duplicate column %q", h)
+		}
+		hmap[k] = i
+	}
+
+	// Every schema name and alias resolves to its column.
+	lookup := make(map[string]int)
+	for i, c := range schema.Columns {
+		lookup[schema.headerKey(c.Name)] = i
+		for _, a := range c.Aliases {
+			lookup[schema.headerKey(a)] = i
+		}
+	}
+
+	hb := &headerBinding{width: len(header), index: make([]int, len(schema.Columns))}
+	for i := range hb.index {
+		hb.index[i] = -1
+	}
+	used := make([]bool, len(header))
+	for i, h := range header {
+		ci, ok := lookup[schema.headerKey(h)]
+		if !ok {
+			continue
+		}
+		c := schema.Columns[ci]
+		if prev := hb.index[ci]; prev >= 0 {
+			return nil, fmt.Errorf("header columns %q and %q both map to schema column %q", header[prev], h, c.Name)
+		}
+		hb.index[ci] = i
+		used[i] = true
+	}
+	for i, c := range schema.Columns {
+		if idx := hb.index[i]; idx >= 0 {
+			if header[idx] != c.Name {
+				hb.aliases = append(hb.aliases, AliasMatch{Column: c.Name, Header: header[idx]})
+			}
+			continue
+		}
+		if !c.OptionalInHeader {
+			return nil, fmt.Errorf("header missing required column %q", c.Name)
+		}
+		hb.missing = append(hb.missing, c.Name)
+	}
+
+	var extras []int
+	for i := range header {
+		if !used[i] {
+			extras = append(extras, i)
+		}
+	}
+	if len(extras) > 0 {
+		switch schema.extraColumns() {
+		case ExtraDrop:
+			for _, i := range extras {
+				hb.dropped = append(hb.dropped, header[i])
+			}
+		case ExtraPassthrough:
+			hb.passthrough = extras
+		default:
+			return nil, fmt.Errorf("header must match schema columns exactly (got %d, want %d)", len(header), len(schema.Columns))
+		}
+	}
+
+	hb.names = make([]string, 0, len(schema.Columns)+len(hb.passthrough))
+	for _, c := range schema.Columns {
+		hb.names = append(hb.names, c.Name)
+	}
+	for _, i := range hb.passthrough {
+		hb.names = append(hb.names, header[i])
+	}
+	return hb, nil
+}
+
+// report lists every header adjustment, or nil if the header matched the
+// schema exactly.
+func (hb *headerBinding) report() *HeaderReport {
+	if len(hb.missing) == 0 && len(hb.dropped) == 0 && len(hb.passthrough) == 0 && len(hb.aliases) == 0 {
+		return nil
+	}
+	r := &HeaderReport{Aliases: hb.aliases, MissingOptional: hb.missing, Dropped: hb.dropped}
+	r.Passthrough = hb.names[len(hb.index):]
+	return r
+}
@@ -0,0 +1,197 @@
+package normalizer
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"io"
+	"os"
+	"sort"
+)
+
+// DefaultKeyMemory is the default memory budget, in bytes, of the in-memory
+// part of each key index (Options.KeyMemory).
+const DefaultKeyMemory = 64 << 20
+
+// keyIndex remembers the first row of every key seen so far. Keys live in a
+// map until it reaches its memory budget; the map is then written to a
+// sorted run file on disk and cleared. Each run keeps only a Bloom filter
+// and a sparse index in memory, so a lookup reads at most one small block
+// from disk. Results never depend on the budget, only speed does.
+type keyIndex struct {
+	mem      map[string]int
+	memBytes int
+	limit    int
+	dir      string
+	runs     []*keyRun
+}
+
+// Rough per-entry cost of a Go map[string]int entry besides the key bytes.
+const keyEntryOverhead = 48
+
+func newKeyIndex(limit int, dir string) *keyIndex {
+	if limit <= 0 {
+		limit = DefaultKeyMemory
+	}
+	return &keyIndex{mem: map[string]int{}, limit: limit, dir: dir}
+}
+
+// lookup returns the row key was recorded at, or 0 if it was not.
+func (x *keyIndex) lookup(key string) (int, error) {
+	if r, ok := x.mem[key]; ok {
+		return r, nil
+	}
+	for _, run := range x.runs {
+		r, ok, err := run.lookup(key)
+		if err != nil || ok {
+			return r, err
+		}
+	}
+	return 0, nil
+}
+
+// insert records a key that lookup did not find.
+func (x *keyIndex) insert(key string, row int) error {
+	x.mem[key] = row
+	x.memBytes += len(key) + keyEntryOverhead
+	if x.memBytes >= x.limit {
+		return x.spill()
+	}
+	return nil
+}
+
+// close removes the run files.
+func (x *keyIndex) close() {
+	for _, run := range x.runs {
+		run.f.Close()
+		os.Remove(run.f.Name())
+	}
+	x.runs = nil
+}
+
+// Every keyBlock-th entry of a run is kept in its sparse index.
+const keyBlock = 32
+
+// keyRun is one sorted spill file: entries of uvarint(len(key)), key,
+// uvarint(row).
+type keyRun struct {
+	f      *os.File
+	bloom  bloom
+	index  []string // first key of each block
+	offset []int64  // file offset of each block
+	size   int64
+}
+
+func (x *keyIndex) spill() error {
+	keys := make([]string, 0, len(x.mem))
+	for k := range x.mem {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	f, err := os.CreateTemp(x.dir, "normalizer-keys-*.run")
+	if err != nil {
+		return err
+	}
+	run := &keyRun{f: f, bloom: newBloom(len(keys))}
+	x.runs = append(x.runs, run) // so close removes it even if writing fails
+
+	w := bufio.NewWriter(f)
+	var buf [binary.MaxVarintLen64]byte
+	var off int64
+	for i, k := range keys {
+		if i%keyBlock == 0 {
+			run.index = append(run.index, k)
+			run.offset = append(run.offset, off)
+		}
+		run.bloom.add(k)
+		n := binary.PutUvarint(buf[:], uint64(len(k)))
+		w.Write(buf[:n])
+		w.WriteString(k)
+		m := binary.PutUvarint(buf[:], uint64(x.mem[k]))
+		w.Write(buf[:m])
+		off += int64(n + len(k) + m)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	run.size = off
+
+	x.mem = map[string]int{}
+	x.memBytes = 0
+	return nil
+}
+
+func (run *keyRun) lookup(key string) (int, bool, error) {
+	if !run.bloom.has(key) {
+		return 0, false, nil
+	}
+	// Last block whose first key is <= key.
+	b := sort.Search(len(run.index), func(i int) bool { return run.index[i] > key }) - 1
+	if b < 0 {
+		return 0, false, nil
+	}
+	end := run.size
+	if b+1 < len(run.offset) {
+		end = run.offset[b+1]
+	}
+	r := bufio.NewReader(io.NewSectionReader(run.f, run.offset[b], end-run.offset[b]))
+	for {
+		n, err := binary.ReadUvarint(r)
+		if errors.Is(err, io.EOF) {
+			return 0, false, nil
+		}
+		if err != nil {
+			return 0, false, err
+		}
+		k := make([]byte, n)
+		if _, err := io.ReadFull(r, k); err != nil {
+			return 0, false, err
+		}
+		row, err := binary.ReadUvarint(r)
+		if err != nil {
+			return 0, false, err
+		}
+		switch {
+		case string(k) == key:
+			return int(row), true, nil
+		case string(k) > key:
+			return 0, false, nil
+		}
+	}
+}
+
+// bloom is a Bloom filter sized for about 1% false positives.
+type bloom []uint64
+
+const bloomHashes = 7
+
+func newBloom(n int) bloom {
+	bits := 10 * n
+	if bits < 64 {
+		bits = 64
+	}
+	return make(bloom, (bits+63)/64)
+}
+
+func (b bloom) positions(key string, fn func(uint64)) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	h1, h2 := sum&0xffffffff, sum>>32|1
+	m := uint64(len(b)) * 64
+	for i := uint64(0); i < bloomHashes; i++ {
+		fn((h1 + i*h2) % m)
+	}
+}
+
+func (b bloom) add(key string) {
+	b.positions(key, func(p uint64) { b[p/64] |= 1 << (p % 64) })
+}
+
+func (b bloom) has(key string) bool {
+	ok := true
+	b.positions(key, func(p uint64) { ok = ok && b[p/64]&(1<<(p%64)) != 0 })
+	return ok
+}
@@ -0,0 +1,128 @@
+package normalizer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+func (s *Schema) validateKeys() error {
+	seen := map[string]bool{}
+	for _, name := range s.PrimaryKey {
+		i := s.columnIndex(name)
+		if i < 0 {
+			return fmt.Errorf("schema: primary_key: no such column %q", name)
+		}
+		if seen[name] {
+			return fmt.Errorf("schema: primary_key: duplicate column %q", name)
+		}
+		seen[name] = true
+		if !s.Columns[i].Required {
+			return fmt.Errorf("schema: primary_key: column %q must be required", name)
+		}
+	}
+	for _, c := range s.Columns {
+		if c.Unique && len(s.PrimaryKey) == 1 && s.PrimaryKey[0] == c.Name {
+			return fmt.Errorf("schema: column[%s]: unique is implied by primary_key", c.Name)
+		}
+	}
+	return nil
+}
+
+func (s *Schema) columnIndex(name string) int {
+	for i := range s.Columns {
+		if s.Columns[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// keyConstraint is the primary key or one unique column, checked on
+// normalized values (so "007" and "7" are the same integer) against the
+// rows written to normalized.csv.
+type keyConstraint struct {
+	cols    []int // schema column indices
+	names   []string
+	primary bool
+	index   *keyIndex
+}
+
+// compileKeys returns the primary key (if any), then each unique column in
+// schema order. With dedupe "key" the primary key is enforced by dropping
+// repeats instead, so it is not returned.
+func compileKeys(s *Schema, spec runSpec) []*keyConstraint {
+	var keys []*keyConstraint
+	if len(s.PrimaryKey) > 0 && s.Dedupe != DedupeKey {
+		k := &keyConstraint{primary: true, names: s.PrimaryKey, index: newKeyIndex(spec.keyMemory, spec.tempDir)}
+		for _, name := range s.PrimaryKey {
+			k.cols = append(k.cols, s.columnIndex(name))
+		}
+		keys = append(keys, k)
+	}
+	for i, c := range s.Columns {
+		if c.Unique {
+			keys = append(keys, &keyConstraint{cols: []int{i}, names: []string{c.Name}, index: newKeyIndex(spec.keyMemory, spec.tempDir)})
+		}
+	}
+	return keys
+}
+
+// key returns the encoded key of a row and its values, or ok == false if a
+// key column is blank.
+func (k *keyConstraint) key(outRec []string) (key string, vals []string, ok bool) {
+	var b []byte
+	vals = make([]string, len(k.cols))
+	for j, i := range k.cols {
+		if outRec[i] == "" {
+			return "", nil, false
+		}
+		vals[j] = outRec[i]
+		b = binary.AppendUvarint(b, uint64(len(outRec[i])))
+		b = append(b, outRec[i]...)
+	}
+	return string(b), vals, true
+}
+
+// check returns ERR_DUPLICATE_KEY if a row already written to
+// normalized.csv had the same key. Rows with a blank key column have no
+// key and are skipped. check does not record the key; see record.
+func (k *keyConstraint) check(outRec []string, row int) (*RowError, error) {
+	key, vals, ok := k.key(outRec)
+	if !ok {
+		return nil, nil
+	}
+	first, err := k.index.lookup(key)
+	if err != nil || first == 0 {
+		return nil, err
+	}
+
+	e := &RowError{Row: row, Code: "ERR_DUPLICATE_KEY", Value: strings.Join(vals, ",")}
+	switch {
+	case !k.primary:
+		e.Field = k.names[0]
+		e.Message = fmt.Sprintf("duplicate unique value (first seen at row %d)", first)
+	case len(k.cols) == 1:
+		e.Field = k.names[0]
+		e.Message = fmt.Sprintf("duplicate primary key (first seen at row %d)", first)
+	default:
+		e.Message = fmt.Sprintf("duplicate primary key (%s) (first seen at row %d)", strings.Join(k.names, ", "), first)
+	}
+	return e, nil
+}
+
+// record remembers the key of a row that passed every check, so keys of
+// rejected rows never make a later row a duplicate.
+func (k *keyConstraint) record(outRec []string, row int) error {
+	key, _, ok := k.key(outRec)
+	if !ok {
+		return nil
+	}
+	return k.index.insert(key, row)
+}
+
+func closeKeys(keys []*keyConstraint) {
+	for _, k := range keys {
+		k.index.close()
+	}
+}
@@ -0,0 +1,686 @@
+package normalizer
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Options carries the run metadata recorded in report.json.
+type Options struct {
+	Tool    string
+	Version string
+	Label   string // stable input label (recommended)
+	Schema  string // schema path (as provided)
+	Input   string // input path (as provided)
+
+	// Dialect, if non-nil, replaces the schema's dialect for this run.
+	Dialect *Dialect
+	// Encoding, if set, replaces the schema's input encoding for this run.
+	Encoding string
+
+	// ExpectRows and ExpectSums (column name -> total) are control totals
+	// given directly, e.g. from flags; they take precedence over the
+	// schema's trailer groups.
+	ExpectRows *int
+	ExpectSums map[string]string
+
+	// KeyMemory is the memory budget in bytes of each primary key, unique,
+	// dedupe and per-column distinct-value index before it spills to disk
+	// (default DefaultKeyMemory). TempDir is where spill files go (default
+	// os.TempDir()).
+	KeyMemory int
+	TempDir   string
+
+	// SortMemory is the memory budget in bytes for sorting normalized rows
+	// (schema sort_by) before sorted runs spill to disk (default
+	// DefaultSortMemory).
+	SortMemory int
+}
+
+// Result summarizes a validation or normalization run.
+type Result struct {
+	RowsTotal     int
+	RowsOK        int
+	RowsError     int
+	RowsDuplicate int // rows dropped by dedupe (not counted in RowsOK)
+	Cols          int
+
+	ControlMismatches int // control totals that disagreed (on_mismatch "flag")
+
+	ErrorsByCode []CodeCount // row errors per code, sorted by code
+}
+
+// RowError is one row-level validation failure, as written to errors.csv.
+// Field is empty for errors that apply to the whole row.
+type RowError struct {
+	Row     int
+	Field   string
+	Code    string
+	Message string
+	Value   string
+}
+
+func isBlankRecord(rec []string) bool {
+	if len(rec) == 0 {
+		return true
+	}
+	for _, f := range rec {
+		if strings.TrimSpace(f) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Outputs are the sinks Normalize writes to. A nil writer discards its
+// output; its digest is still recorded in the report.
+type Outputs struct {
+	Normalized io.Writer // normalized.csv
+	Errors     io.Writer // errors.csv
+	Report     io.Writer // report.json
+	Duplicates io.Writer // duplicates.csv (schema dedupe only)
+}
+
+// ValidateCSV checks inPath against the schema at schemaPath without writing
+// any output. Row errors are returned sorted by (row, field, code); file-level
+// problems (bad schema, header mismatch, invalid UTF-8) are returned as err.
+// opt applies as for NormalizeCSV; Input and Schema default to the paths.
+func ValidateCSV(inPath, schemaPath string, opt Options) (Result, []RowError, error) {
+	schema, _, err := LoadSchema(schemaPath)
+	if err != nil {
+		return Result{}, nil, err
+	}
+
+	f, err := os.Open(inPath)
+	if err != nil {
+		return Result{}, nil, err
+	}
+	defer f.Close()
+
+	if opt.Input == "" {
+		opt.Input = inPath
+	}
+	if opt.Schema == "" {
+		opt.Schema = schemaPath
+	}
+	return Validate(context.Background(), f, schema, opt)
+}
+
+// Validate is ValidateCSV over an arbitrary reader and an already parsed
+// schema. Cancellation of ctx is checked between rows.
+func Validate(ctx context.Context, in io.Reader, schema *Schema, opt Options) (Result, []RowError, error) {
+	if err := schema.validate(); err != nil {
+		return Result{}, nil, err
+	}
+	spec, err := resolveRun(schema, opt)
+	if err != nil {
+		return Result{}, nil, err
+	}
+	checks, err := controlPlan(schema, opt)
+	if err != nil {
+		return Result{}, nil, err
+	}
+
+	var errs []RowError
+	scan, err := scanCSV(ctx, in, schema, spec, rowHandler{
+		header: func([]string) error { return nil },
+		ok:     func([]string) error { return nil },
+		bad: func(es []RowError) error {
+			errs = append(errs, es...)
+			return nil
+		},
+		dup: func([]string, int, int) error { return nil },
+	})
+	if err != nil {
+		return Result{}, nil, err
+	}
+	totals, err := reconcile(checks, schema, scan)
+	if err != nil && !schema.flagMismatches() {
+		return Result{}, nil, err
+	}
+	scan.ControlMismatches = countMismatches(totals)
+	return scan.Result, errs, nil
+}
+
+// NormalizeCSV validates inPath against the schema at schemaPath and writes
+// normalized.csv, errors.csv and report.json into outDir. Outputs are only
+// put in place if the whole input is accepted.
+func NormalizeCSV(inPath, schemaPath, outDir string, opt Options) (Result, error) {
+	schema, _, err := LoadSchema(schemaPath)
+	if err != nil {
+		return Result{}, err
+	}
+
+	in, err := os.Open(inPath)
+	if err != nil {
+		return Result{}, err
+	}
+	defer in.Close()
+
+	// Outputs are streamed straight into temp files and only renamed into
+	// place once the whole input has been accepted. A failed run leaves no
+	// trace, including an out dir it created.
+	undoDir, err := makeOutDir(outDir)
+	if err != nil {
+		return Result{}, err
+	}
+	var files []*atomicFile
+	committed := false
+	defer func() {
+		for _, f := range files {
+			f.Abort()
+		}
+		if !committed {
+			undoDir()
+		}
+	}()
+	names := []string{"normalized.csv", "errors.csv", "report.json"}
+	if schema.dedupes() {
+		names = append(names, "duplicates.csv")
+	}
+	for _, name := range names {
+		f, err := createAtomic(outDir, name)
+		if err != nil {
+			return Result{}, err
+		}
+		files = append(files, f)
+	}
+
+	outs := Outputs{
+		Normalized: files[0],
+		Errors:     files[1],
+		Report:     files[2],
+	}
+	if schema.dedupes() {
+		outs.Duplicates = files[3]
+	}
+	res, err := Normalize(context.Background(), in, schema, outs, opt)
+	if err != nil {
+		return Result{}, err
+	}
+
+	committed = true
+	for _, f := range files {
+		if err := f.Commit(); err != nil {
+			return Result{}, err
+		}
+	}
+	return res, nil
+}
+
+// Normalize streams in once, writing normalized.csv, errors.csv and
+// report.json to out. The report is written last, after the input has been
+// fully accepted. Cancellation of ctx is checked between rows and while
+// sorted runs are merged.
+func Normalize(ctx context.Context, in io.Reader, schema *Schema, out Outputs, opt Options) (Result, error) {
+	if err := schema.validate(); err != nil {
+		return Result{}, err
+	}
+	spec, err := resolveRun(schema, opt)
+	if err != nil {
+		return Result{}, err
+	}
+	checks, err := controlPlan(schema, opt)
+	if err != nil {
+		return Result{}, err
+	}
+	schemaSHA, err := schema.sha256()
+	if err != nil {
+		return Result{}, err
+	}
+
+	norm := newHashedCSV(orDiscard(out.Normalized))
+	errw := newHashedCSV(orDiscard(out.Errors))
+
+	if err := errw.Write([]string{"row", "field", "code", "message", "value"}); err != nil {
+		return Result{}, err
+	}
+	var dupw *hashedCSV
+	if schema.dedupes() {
+		dupw = newHashedCSV(orDiscard(out.Duplicates))
+	}
+
+	// With sort_by, OK rows are collected and written in order after the
+	// scan; errors.csv stays in input order either way.
+	okRow := norm.Write
+	var sorter *rowSorter
+	if len(schema.SortBy) > 0 {
+		sorter = newRowSorter(schema, spec)
+		defer sorter.close()
+		okRow = sorter.add
+	}
+
+	scan, err := scanCSV(ctx, in, schema, spec, rowHandler{
+		header: func(names []string) error {
+			if dupw != nil {
+				if err := dupw.Write(append([]string{"row", "first_row"}, names...)); err != nil {
+					return err
+				}
+			}
+			return norm.Write(names)
+		},
+		ok: okRow,
+		bad: func(es []RowError) error {
+			for _, e := range es {
+				if err := errw.Write([]string{
+					fmt.Sprintf("%d", e.Row),
+					e.Field,
+					e.Code,
+					e.Message,
+					e.Value,
+				}); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		dup: func(rec []string, row, first int) error {
+			return dupw.Write(append([]string{strconv.Itoa(row), strconv.Itoa(first)}, rec...))
+		},
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	if sorter != nil {
+		if err := sorter.emit(ctx, norm.Write); err != nil {
+			return Result{}, err
+		}
+	}
+	if err := norm.Flush(); err != nil {
+		return Result{}, err
+	}
+	if err := errw.Flush(); err != nil {
+		return Result{}, err
+	}
+	if dupw != nil {
+		if err := dupw.Flush(); err != nil {
+			return Result{}, err
+		}
+	}
+	totals, err := reconcile(checks, schema, scan)
+	if err != nil && !schema.flagMismatches() {
+		return Result{}, err
+	}
+	scan.ControlMismatches = countMismatches(totals)
+
+	// report.json (stable ordering via struct)
+	rep := buildReport(scan, opt)
+	rep.Sha256Schema = schemaSHA
+	rep.Sha256Normalized = norm.Sum()
+	rep.Sha256Errors = errw.Sum()
+	rep.ControlTotals = totals
+	if dupw != nil {
+		rep.GeneratedFiles = append(rep.GeneratedFiles, "duplicates.csv")
+		rep.Duplicates = &DuplicatesReport{Mode: schema.Dedupe, Rows: scan.RowsDuplicate, Sha256: dupw.Sum()}
+	}
+
+	repBytes, err := json.MarshalIndent(rep, "", "  ")
+	if err != nil {
+		return Result{}, err
+	}
+	repBytes = append(repBytes, '\n')
+	if _, err := orDiscard(out.Report).Write(repBytes); err != nil {
+		return Result{}, err
+	}
+
+	return scan.Result, nil
+}
+
+// runSpec is how a run reads its input bytes, plus its resource limits.
+type runSpec struct {
+	encoding   string
+	dialect    Dialect
+	keyMemory  int
+	sortMemory int
+	tempDir    string
+}
+
+// resolveRun resolves the encoding and dialect for a run: the Options
+// overrides if set, else the schema's, with defaults filled in.
+func resolveRun(schema *Schema, opt Options) (runSpec, error) {
+	spec := runSpec{encoding: schema.Encoding, keyMemory: opt.KeyMemory, sortMemory: opt.SortMemory, tempDir: opt.TempDir}
+	if opt.Encoding != "" {
+		spec.encoding = opt.Encoding
+	}
+	if !validEncoding(spec.encoding) {
+		return runSpec{}, fmt.Errorf("invalid encoding %q", spec.encoding)
+	}
+	if spec.encoding == "" {
+		spec.encoding = EncodingUTF8
+	}
+
+	switch {
+	case opt.Dialect != nil:
+		spec.dialect = *opt.Dialect
+	case schema.Dialect != nil:
+		spec.dialect = *schema.Dialect
+	}
+	if err := spec.dialect.validate(); err != nil {
+		return runSpec{}, err
+	}
+	spec.dialect = spec.dialect.withDefaults()
+	return spec, nil
+}
+
+func orDiscard(w io.Writer) io.Writer {
+	if w == nil {
+		return io.Discard
+	}
+	return w
+}
+
+// rowHandler receives the normalized header once, then the outcome of each
+// data row in input order: the normalized record of an OK row, the (sorted)
+// errors of a bad one, or a row dropped by dedupe with the row it repeats.
+type rowHandler struct {
+	header func(names []string) error
+	ok     func(rec []string) error
+	bad    func(errs []RowError) error
+	dup    func(rec []string, row, first int) error
+}
+
+// scanResult is what the single pass learns besides the rows themselves.
+type scanResult struct {
+	Result
+	inputSHA string
+	cols     []column // with per-run counters filled in
+	rawSHA   string
+	header   *HeaderReport
+	input    runSpec
+	preamble []string
+	trailer  []string
+	byField  []FieldCount
+	sums     controlSums
+}
+
+// scanCSV is the single pass over the input: canonicalization, UTF-8 checks,
+// header mapping, validation, normalization and the input digest all happen
+// while the CSV is read once, so memory does not grow with the file.
+func scanCSV(ctx context.Context, in io.Reader, schema *Schema, spec runSpec, h rowHandler) (scanResult, error) {
+	raw := sha256.New()
+	cr := newCanonicalReader(newDecodeReader(io.TeeReader(in, raw), spec.encoding))
+	br := bufio.NewReader(cr)
+	preamble, header, err := readPreamble(br, schema, spec.dialect)
+	if err != nil {
+		return scanResult{}, err
+	}
+	r := newRecordReader(br, spec.dialect)
+
+	if header == nil {
+		header, err = r.Read()
+		if err != nil {
+			if isInputError(err) {
+				return scanResult{}, err
+			}
+			return scanResult{}, fmt.Errorf("read header: %w", err)
+		}
+	}
+	hb, err := bindHeader(header, schema)
+	if err != nil {
+		return scanResult{}, err
+	}
+	if err := h.header(hb.names); err != nil {
+		return scanResult{}, err
+	}
+
+	cols := compileColumns(schema, spec)
+	defer closeColumns(cols)
+	colIndex := make(map[string]int, len(cols))
+	for i := range cols {
+		colIndex[cols[i].Name] = i
+	}
+	keys := compileKeys(schema, spec)
+	defer closeKeys(keys)
+	dedupe := newDeduper(schema, spec)
+	defer dedupe.close()
+	rules, err := compileRules(schema)
+	if err != nil {
+		return scanResult{}, err
+	}
+	byCode, byField := map[string]int{}, map[string]int{}
+	bad := func(es []RowError) error {
+		for _, e := range es {
+			byCode[e.Code]++
+			byField[e.Field]++
+			if k, ok := colIndex[e.Field]; ok {
+				cols[k].stats.errors[e.Code]++
+			}
+		}
+		return h.bad(es)
+	}
+	newlineRowErrs := schema.Newlines == NewlinesRowError
+	trailer := newTrailerMatcher(schema, spec.dialect)
+	sums := newControlSums(cols)
+	res := Result{Cols: len(hb.names)}
+	var errs []RowError
+
+	// Skipped preamble lines are counted, so row numbers match the input
+	// file as the user sees it.
+	rowNum := len(preamble) + 1 // header row
+	for {
+		if err := ctx.Err(); err != nil {
+			return scanResult{}, err
+		}
+		rec, e := r.Read()
+		if e != nil {
+			if errors.Is(e, io.EOF) {
+				break
+			}
+			if isInputError(e) {
+				return scanResult{}, e
+			}
+			return scanResult{}, fmt.Errorf("read row: %w", e)
+		}
+		rowNum++
+		if isBlankRecord(rec) {
+			continue
+		}
+		if isTrailer, err := trailer.match(rec, rowNum); err != nil {
+			return scanResult{}, err
+		} else if isTrailer {
+			continue
+		}
+		res.RowsTotal++
+
+		errs = errs[:0]
+		if len(rec) != hb.width {
+			errs = append(errs, RowError{
+				Row:     rowNum,
+				Field:   "",
+				Code:    "ERR_COLUMNS",
+				Message: "wrong number of columns",
+				Value:   fmt.Sprintf("%d", len(rec)),
+			})
+			res.RowsError++
+			if err := bad(errs); err != nil {
+				return scanResult{}, err
+			}
+			continue
+		}
+
+		outRec := make([]string, len(hb.names))
+		for i := range cols {
+			c := &cols[i]
+			var v string
+			if hb.index[i] >= 0 {
+				v = strings.TrimSpace(rec[hb.index[i]])
+			}
+			sums.add(i, v)
+			if !c.AllowNewlines && strings.ContainsAny(v, "\r\n") {
+				if !newlineRowErrs {
+					return scanResult{}, fmt.Errorf("row %d: field %q contains newline", rowNum, c.Name)
+				}
+				errs = append(errs, newlineErr(rowNum, c.Name, v))
+				continue
+			}
+
+			if c.Required && v == "" {
+				errs = append(errs, RowError{
+					Row:     rowNum,
+					Field:   c.Name,
+					Code:    "ERR_REQUIRED",
+					Message: "required value missing",
+					Value:   v,
+				})
+				continue
+			}
+			if v == "" {
+				continue
+			}
+
+			out, verr := normalizeValue(c, v)
+			if verr != nil {
+				verr.Row = rowNum
+				verr.Field = c.Name
+				errs = append(errs, *verr)
+				continue
+			}
+			outRec[i] = out
+		}
+		for k, idx := range hb.passthrough {
+			v := strings.TrimSpace(rec[idx])
+			if strings.ContainsAny(v, "\r\n") {
+				if !newlineRowErrs {
+					return scanResult{}, fmt.Errorf("row %d: field %q contains newline", rowNum, hb.names[len(cols)+k])
+				}
+				errs = append(errs, newlineErr(rowNum, hb.names[len(cols)+k], v))
+				continue
+			}
+			outRec[len(cols)+k] = v
+		}
+
+		if len(rules) > 0 {
+			errs = checkRules(rules, outRec, rowNum, errs)
+		}
+		if len(errs) == 0 && dedupe != nil {
+			first, err := dedupe.lookup(outRec)
+			if err != nil {
+				return scanResult{}, err
+			}
+			if first > 0 {
+				res.RowsDuplicate++
+				if err := h.dup(outRec, rowNum, first); err != nil {
+					return scanResult{}, err
+				}
+				continue
+			}
+		}
+		// Every row's keys are checked, so each repeat is reported even in a
+		// row with other errors; keys are recorded only for rows that are
+		// written, so a rejected row never makes a later row a duplicate.
+		for _, k := range keys {
+			e, err := k.check(outRec, rowNum)
+			if err != nil {
+				return scanResult{}, err
+			}
+			if e != nil {
+				errs = append(errs, *e)
+			}
+		}
+		if len(errs) == 0 {
+			for _, k := range keys {
+				if err := k.record(outRec, rowNum); err != nil {
+					return scanResult{}, err
+				}
+			}
+			if dedupe != nil {
+				if err := dedupe.record(outRec, rowNum); err != nil {
+					return scanResult{}, err
+				}
+			}
+		}
+
+		if len(errs) > 0 {
+			res.RowsError++
+			sortRowErrs(errs)
+			if err := bad(errs); err != nil {
+				return scanResult{}, err
+			}
+			continue
+		}
+		res.RowsOK++
+		for i := range cols {
+			if err := cols[i].stats.written(&cols[i], outRec[i]); err != nil {
+				return scanResult{}, err
+			}
+		}
+		if err := h.ok(outRec); err != nil {
+			return scanResult{}, err
+		}
+	}
+
+	res.ErrorsByCode = codeCounts(byCode)
+	var fields []FieldCount
+	for _, f := range append([]string{""}, hb.names...) {
+		if n := byField[f]; n > 0 {
+			fields = append(fields, FieldCount{Field: f, Count: n})
+		}
+	}
+
+	return scanResult{
+		Result:   res,
+		byField:  fields,
+		sums:     sums,
+		inputSHA: cr.Sum(),
+		rawSHA:   hexSum(raw),
+		cols:     cols,
+		header:   hb.report(),
+		input:    spec,
+		preamble: preamble,
+		trailer:  trailer.report(),
+	}, nil
+}
+
+func newlineErr(row int, field, v string) RowError {
+	return RowError{
+		Row:     row,
+		Field:   field,
+		Code:    "ERR_NEWLINE",
+		Message: "field contains newline",
+		Value:   v,
+	}
+}
+
+// sortRowErrs orders one row's errors by field, then code. Rows are already
+// visited in input order, so the stream as a whole is sorted by
+// (row, field, code).
+func sortRowErrs(errs []RowError) {
+	sort.SliceStable(errs, func(i, j int) bool {
+		if errs[i].Field != errs[j].Field {
+			return errs[i].Field < errs[j].Field
+		}
+		return errs[i].Code < errs[j].Code
+	})
+}
+
+// hashedCSV is a csv.Writer whose output is also hashed, so digests of the
+// emitted files never need the bytes held in memory.
+type hashedCSV struct {
+	*csv.Writer
+	sum hash.Hash
+}
+
+func newHashedCSV(w io.Writer) *hashedCSV {
+	sum := sha256.New()
+	return &hashedCSV{Writer: csv.NewWriter(io.MultiWriter(w, sum)), sum: sum}
+}
+
+func (w *hashedCSV) Flush() error {
+	w.Writer.Flush()
+	return w.Writer.Error()
+}
+
+func (w *hashedCSV) Sum() string {
+	return hexSum(w.sum)
+}
@@ -0,0 +1,138 @@
+package normalizer
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// defaultPreambleMaxLines bounds the header search of Preamble.FindHeader.
+const defaultPreambleMaxLines = 100
+
+// Preamble says which lines before the header are not data. Skipped lines
+// are listed under "preamble" in report.json.
+type Preamble struct {
+	SkipLines  int  `json:"skip_lines,omitempty"`  // skip exactly this many lines
+	FindHeader bool `json:"find_header,omitempty"` // skip until a line binds as the schema's header
+	MaxLines   int  `json:"max_lines,omitempty"`   // find_header: lines to search (default 100)
+}
+
+// Trailer recognizes summary lines after the data. A record is a trailer
+// line if its fields, joined by the delimiter, fully match Pattern (RE2).
+// Once a trailer line is seen, every later record must be one too.
+type Trailer struct {
+	Pattern string `json:"pattern"`
+}
+
+func (p *Preamble) validate() error {
+	if p.SkipLines < 0 {
+		return fmt.Errorf("schema: preamble: skip_lines must be >= 0")
+	}
+	if p.MaxLines < 0 {
+		return fmt.Errorf("schema: preamble: max_lines must be >= 0")
+	}
+	if p.SkipLines > 0 && p.FindHeader {
+		return fmt.Errorf("schema: preamble: skip_lines and find_header are exclusive")
+	}
+	if p.MaxLines > 0 && !p.FindHeader {
+		return fmt.Errorf("schema: preamble: max_lines requires find_header")
+	}
+	return nil
+}
+
+func (t *Trailer) validate() error {
+	if t.Pattern == "" {
+		return fmt.Errorf("schema: trailer: pattern is empty")
+	}
+	if _, err := regexp.Compile(anchorPattern(t.Pattern)); err != nil {
+		return fmt.Errorf("schema: trailer: invalid pattern: %v", err)
+	}
+	return nil
+}
+
+// readPreamble consumes the preamble lines from br and returns them. In
+// find_header mode it also returns the header record it found (nil
+// otherwise, leaving the header to be read as the next record).
+func readPreamble(br *bufio.Reader, schema *Schema, d Dialect) (lines, header []string, err error) {
+	p := schema.Preamble
+	if p == nil || (p.SkipLines == 0 && !p.FindHeader) {
+		return nil, nil, nil
+	}
+	limit := p.SkipLines
+	if p.FindHeader {
+		limit = p.MaxLines
+		if limit == 0 {
+			limit = defaultPreambleMaxLines
+		}
+	}
+
+	for len(lines) < limit {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			if isInputError(err) {
+				return nil, nil, err
+			}
+			if !errors.Is(err, io.EOF) {
+				return nil, nil, fmt.Errorf("read preamble: %w", err)
+			}
+			if line == "" {
+				break
+			}
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if p.FindHeader {
+			rec, err := newRecordReader(strings.NewReader(line), d).Read()
+			if err == nil {
+				if _, err := bindHeader(rec, schema); err == nil {
+					return lines, append([]string(nil), rec...), nil
+				}
+			}
+		}
+		lines = append(lines, line)
+	}
+	if p.FindHeader {
+		return nil, nil, fmt.Errorf("header not found in first %d lines", limit)
+	}
+	return lines, nil, nil
+}
+
+// trailerMatcher collects trailer lines and rejects data after them.
+type trailerMatcher struct {
+	re    *regexp.Regexp
+	delim string
+	lines []string
+}
+
+func newTrailerMatcher(schema *Schema, d Dialect) *trailerMatcher {
+	if schema.Trailer == nil {
+		return nil
+	}
+	return &trailerMatcher{re: regexp.MustCompile(anchorPattern(schema.Trailer.Pattern)), delim: d.Delimiter}
+}
+
+// match reports whether rec is a trailer line; data after a trailer line is
+// an error.
+func (t *trailerMatcher) match(rec []string, rowNum int) (bool, error) {
+	if t == nil {
+		return false, nil
+	}
+	line := strings.Join(rec, t.delim)
+	if t.re.MatchString(line) {
+		t.lines = append(t.lines, line)
+		return true, nil
+	}
+	if len(t.lines) > 0 {
+		return false, fmt.Errorf("row %d: data after trailer", rowNum)
+	}
+	return false, nil
+}
+
+func (t *trailerMatcher) report() []string {
+	if t == nil {
+		return nil
+	}
+	return t.lines
+}
@@ -0,0 +1,145 @@
+package normalizer
+
+// Report is a struct (not a map) to guarantee stable JSON field ordering.
+type Report struct {
+	Tool             string   `json:"tool"`
+	Version          string   `json:"version"`
+	ReportVersion    int      `json:"report_version"`
+	Input            string   `json:"input"`
+	Schema           string   `json:"schema"`
+	RowsTotal        int      `json:"rows_total"`
+	RowsOK           int      `json:"rows_ok"`
+	RowsError        int      `json:"rows_error"`
+	Cols             int      `json:"cols"`
+	Sha256Input      string   `json:"sha256_input"`
+	Sha256Schema     string   `json:"sha256_schema"`
+	Sha256Normalized string   `json:"sha256_normalized"`
+	Sha256Errors     string   `json:"sha256_errors"`
+	GeneratedFiles   []string `json:"generated_files"`
+
+	Columns []ColumnReport `json:"columns,omitempty"`
+	Header  *HeaderReport  `json:"header,omitempty"`
+	Dialect Dialect        `json:"dialect"` // effective input dialect
+
+	Encoding  string `json:"encoding"`   // declared input encoding
+	Sha256Raw string `json:"sha256_raw"` // input bytes before transcoding and canonicalization
+
+	Preamble []string `json:"preamble,omitempty"` // lines skipped before the header
+	Trailer  []string `json:"trailer,omitempty"`  // trailer records, fields joined by the delimiter
+
+	ControlTotals []ControlTotalReport `json:"control_totals,omitempty"`
+
+	ErrorsByCode  []CodeCount  `json:"errors_by_code,omitempty"`  // sorted by code
+	ErrorsByField []FieldCount `json:"errors_by_field,omitempty"` // row-level (""), then column order
+
+	Duplicates *DuplicatesReport `json:"duplicates,omitempty"` // schema dedupe only
+}
+
+// DuplicatesReport summarizes the rows dedupe dropped into duplicates.csv.
+type DuplicatesReport struct {
+	Mode   string `json:"mode"`
+	Rows   int    `json:"rows"`
+	Sha256 string `json:"sha256_duplicates"`
+}
+
+// ControlTotalReport is the outcome of one control-total check. Code and
+// Message are only set on a mismatch.
+type ControlTotalReport struct {
+	Check    string `json:"check"` // "rows" or "sum"
+	Column   string `json:"column,omitempty"`
+	Source   string `json:"source"` // "trailer" or "option"
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+	Code     string `json:"code,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+// HeaderReport lists how the input header differed from the schema, so no
+// column is added or dropped silently.
+type HeaderReport struct {
+	Aliases         []AliasMatch `json:"aliases,omitempty"`
+	MissingOptional []string     `json:"missing_optional,omitempty"`
+	Dropped         []string     `json:"dropped,omitempty"`
+	Passthrough     []string     `json:"passthrough,omitempty"`
+}
+
+// AliasMatch records that a schema column was found under one of its
+// aliases rather than its own name.
+type AliasMatch struct {
+	Column string `json:"column"`
+	Header string `json:"header"`
+}
+
+// ColumnReport is the per-column section of report.json, in schema order.
+// Min and Max are set for date, timestamp, decimal and integer columns (in
+// normalized form), Sum for decimal columns; all are exact.
+type ColumnReport struct {
+	Name    string        `json:"name"`
+	Formats []FormatCount `json:"formats,omitempty"`
+
+	Blanks   int         `json:"blanks"`
+	Errors   []CodeCount `json:"errors,omitempty"` // by code, sorted by code
+	Distinct int         `json:"distinct"`         // distinct normalized values
+	Min      string      `json:"min,omitempty"`
+	Max      string      `json:"max,omitempty"`
+	Sum      string      `json:"sum,omitempty"`
+}
+
+// FieldCount is how many errors were reported against one field; Field is
+// empty for errors about the whole row.
+type FieldCount struct {
+	Field string `json:"field"`
+	Count int    `json:"count"`
+}
+
+// CodeCount is how many errors had one code.
+type CodeCount struct {
+	Code  string `json:"code"`
+	Count int    `json:"count"`
+}
+
+// FormatCount is how many values of a date column matched one declared
+// input format.
+type FormatCount struct {
+	Format string `json:"format"`
+	Count  int    `json:"count"`
+}
+
+// buildReport fills in everything the scan knows; output digests are added
+// by the caller once the outputs are flushed.
+func buildReport(scan scanResult, opt Options) Report {
+	inputLabel := opt.Label
+	if inputLabel == "" {
+		inputLabel = opt.Input
+	}
+	rep := Report{
+		Tool:           opt.Tool,
+		Version:        opt.Version,
+		ReportVersion:  ReportVersion,
+		Input:          inputLabel,
+		Schema:         opt.Schema,
+		RowsTotal:      scan.RowsTotal,
+		RowsOK:         scan.RowsOK,
+		RowsError:      scan.RowsError,
+		Cols:           scan.Cols,
+		Sha256Input:    scan.inputSHA,
+		GeneratedFiles: []string{"normalized.csv", "errors.csv", "report.json"},
+		Header:         scan.header,
+		Dialect:        scan.input.dialect,
+		Encoding:       scan.input.encoding,
+		Sha256Raw:      scan.rawSHA,
+		Preamble:       scan.preamble,
+		Trailer:        scan.trailer,
+		ErrorsByCode:   scan.ErrorsByCode,
+		ErrorsByField:  scan.byField,
+	}
+	for i := range scan.cols {
+		c := &scan.cols[i]
+		cr := c.stats.report(c)
+		for j, f := range c.Formats {
+			cr.Formats = append(cr.Formats, FormatCount{Format: f, Count: c.formatHits[j]})
+		}
+		rep.Columns = append(rep.Columns, cr)
+	}
+	return rep
+}
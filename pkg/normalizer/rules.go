@@ -0,0 +1,525 @@
+package normalizer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Rule is a cross-field check on the normalized values of a row. Expr must
+// hold for every row; a row where it does not gets a row-level error (field
+// "") whose code is ID. IDs must not start with ERR_, which is reserved for
+// the built-in codes.
+//
+// Expressions combine comparisons (= != < <= > >=) of columns with each
+// other or with literals, blank(col) and present(col), and/or/not and
+// parentheses. Values compare by column type: dates and timestamps by
+// instant, decimals and integers by value, strings bytewise. Literals are
+// quoted strings, numbers, true/false, dates as 'YYYY-MM-DD' and
+// timestamps in RFC 3339. A comparison with a blank side is false. Columns
+// are referenced by name, or as [name] when the name is not a plain
+// identifier (spaces, non-ASCII letters) or is a keyword.
+type Rule struct {
+	ID      string `json:"id"`
+	Expr    string `json:"expr"`
+	Message string `json:"message,omitempty"` // default "rule failed: <expr>"
+}
+
+var ruleIDPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+func (s *Schema) validateRules() error {
+	_, err := compileRules(s)
+	return err
+}
+
+// rule is a type-checked Rule.
+type rule struct {
+	Rule
+	expr ruleExpr
+	refs []string // columns read, in first-use order
+	cols []int
+}
+
+func compileRules(s *Schema) ([]*rule, error) {
+	var rules []*rule
+	seen := map[string]bool{}
+	for _, r := range s.Rules {
+		if !ruleIDPattern.MatchString(r.ID) {
+			return nil, fmt.Errorf("schema: rules: invalid id %q", r.ID)
+		}
+		if strings.HasPrefix(strings.ToUpper(r.ID), "ERR_") {
+			return nil, fmt.Errorf("schema: rules: id %q: the ERR_ prefix is reserved for built-in codes", r.ID)
+		}
+		if seen[r.ID] {
+			return nil, fmt.Errorf("schema: rules: duplicate id %q", r.ID)
+		}
+		seen[r.ID] = true
+
+		toks, err := lexRule(r.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("schema: rules[%s]: %w", r.ID, err)
+		}
+		p := &ruleParser{s: s, toks: toks}
+		e, err := p.parseOr()
+		if err == nil && p.pos < len(p.toks) {
+			err = fmt.Errorf("unexpected %q", p.toks[p.pos].text)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("schema: rules[%s]: %w", r.ID, err)
+		}
+		cr := &rule{Rule: r, expr: e, cols: p.refs}
+		for _, i := range p.refs {
+			cr.refs = append(cr.refs, s.Columns[i].Name)
+		}
+		rules = append(rules, cr)
+	}
+	return rules, nil
+}
+
+// checkRules appends an error for every rule the row breaks, in schema
+// order. A rule that reads a column already rejected in this row is
+// skipped, since that column has no value to check.
+func checkRules(rules []*rule, outRec []string, row int, errs []RowError) []RowError {
+	failed := map[string]bool{}
+	for _, e := range errs {
+		failed[e.Field] = true
+	}
+next:
+	for _, r := range rules {
+		for _, name := range r.refs {
+			if failed[name] {
+				continue next
+			}
+		}
+		if r.expr.eval(outRec) {
+			continue
+		}
+		msg := r.Message
+		if msg == "" {
+			msg = "rule failed: " + r.Expr
+		}
+		vals := make([]string, len(r.cols))
+		for j, i := range r.cols {
+			vals[j] = r.refs[j] + "=" + outRec[i]
+		}
+		errs = append(errs, RowError{Row: row, Code: r.ID, Message: msg, Value: strings.Join(vals, ",")})
+	}
+	return errs
+}
+
+// ruleExpr is a compiled rule expression over a normalized record.
+type ruleExpr interface {
+	eval(rec []string) bool
+}
+
+type andExpr struct{ l, r ruleExpr }
+
+func (e andExpr) eval(rec []string) bool { return e.l.eval(rec) && e.r.eval(rec) }
+
+type orExpr struct{ l, r ruleExpr }
+
+func (e orExpr) eval(rec []string) bool { return e.l.eval(rec) || e.r.eval(rec) }
+
+type notExpr struct{ x ruleExpr }
+
+func (e notExpr) eval(rec []string) bool { return !e.x.eval(rec) }
+
+// blankExpr is blank(col), or present(col) when present is set.
+type blankExpr struct {
+	col     int
+	present bool
+}
+
+func (e blankExpr) eval(rec []string) bool { return (rec[e.col] == "") != e.present }
+
+// cmpExpr compares two operands; kind is the column type that decides how.
+type cmpExpr struct {
+	op   string
+	kind string
+	l, r ruleOperand
+}
+
+func (e cmpExpr) eval(rec []string) bool {
+	a, b := e.l.value(rec), e.r.value(rec)
+	if a.blank || b.blank {
+		return false
+	}
+	c := compareSortValues(e.kind, a, b)
+	switch e.op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	}
+	return c >= 0
+}
+
+// ruleOperand is a column (col >= 0) or a literal already converted to the
+// type of the column it is compared with.
+type ruleOperand struct {
+	col int
+	c   Column
+	lit sortValue
+
+	tok ruleToken // literal as written, until it is typed
+}
+
+func (o ruleOperand) value(rec []string) sortValue {
+	if o.col < 0 {
+		return o.lit
+	}
+	return sortCol{idx: o.col, c: o.c}.value(rec[o.col])
+}
+
+// Token kinds.
+const (
+	tokIdent = iota
+	tokString
+	tokNumber
+	tokOp
+	tokLParen
+	tokRParen
+)
+
+type ruleToken struct {
+	kind   int
+	text   string
+	quoted bool // [bracketed] identifier: always a column, never a keyword
+}
+
+// ruleKeywords cannot be used bare as column names; write [name] instead.
+var ruleKeywords = map[string]bool{
+	"and": true, "or": true, "not": true, "blank": true, "present": true, "true": true, "false": true,
+}
+
+func lexRule(src string) ([]ruleToken, error) {
+	var toks []ruleToken
+	isDigit := func(b byte) bool { return b >= '0' && b <= '9' }
+	isIdent := func(b byte) bool {
+		return b == '_' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || isDigit(b)
+	}
+	for i := 0; i < len(src); {
+		ch := src[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			i++
+		case ch == '[':
+			// [column name]; a doubled ] stands for itself.
+			var b strings.Builder
+			j := i + 1
+			for {
+				if j >= len(src) {
+					return nil, fmt.Errorf("unterminated [column] at offset %d", i)
+				}
+				if src[j] == ']' {
+					if j+1 < len(src) && src[j+1] == ']' {
+						b.WriteByte(']')
+						j += 2
+						continue
+					}
+					break
+				}
+				b.WriteByte(src[j])
+				j++
+			}
+			if b.Len() == 0 {
+				return nil, fmt.Errorf("empty [column] at offset %d", i)
+			}
+			toks = append(toks, ruleToken{kind: tokIdent, text: b.String(), quoted: true})
+			i = j + 1
+		case ch == '(':
+			toks = append(toks, ruleToken{kind: tokLParen, text: "("})
+			i++
+		case ch == ')':
+			toks = append(toks, ruleToken{kind: tokRParen, text: ")"})
+			i++
+		case ch == '\'' || ch == '"':
+			// A doubled quote stands for itself.
+			var b strings.Builder
+			j := i + 1
+			for {
+				if j >= len(src) {
+					return nil, fmt.Errorf("unterminated string at offset %d", i)
+				}
+				if src[j] == ch {
+					if j+1 < len(src) && src[j+1] == ch {
+						b.WriteByte(ch)
+						j += 2
+						continue
+					}
+					break
+				}
+				b.WriteByte(src[j])
+				j++
+			}
+			toks = append(toks, ruleToken{kind: tokString, text: b.String()})
+			i = j + 1
+		case isDigit(ch) || ch == '.' || (ch == '-' || ch == '+') && i+1 < len(src) && (isDigit(src[i+1]) || src[i+1] == '.'):
+			j := i + 1
+			for j < len(src) && (isDigit(src[j]) || src[j] == '.') {
+				j++
+			}
+			toks = append(toks, ruleToken{kind: tokNumber, text: src[i:j]})
+			i = j
+		case isIdent(ch):
+			j := i
+			for j < len(src) && isIdent(src[j]) {
+				j++
+			}
+			toks = append(toks, ruleToken{kind: tokIdent, text: src[i:j]})
+			i = j
+		case strings.IndexByte("=!<>", ch) >= 0:
+			op := src[i : i+1]
+			if i+1 < len(src) && (src[i+1] == '=' || ch == '<' && src[i+1] == '>') {
+				op = src[i : i+2]
+			}
+			switch op {
+			case "!":
+				return nil, fmt.Errorf("unexpected %q at offset %d", ch, i)
+			case "==":
+				toks = append(toks, ruleToken{kind: tokOp, text: "="})
+			case "<>":
+				toks = append(toks, ruleToken{kind: tokOp, text: "!="})
+			default:
+				toks = append(toks, ruleToken{kind: tokOp, text: op})
+			}
+			i += len(op)
+		default:
+			return nil, fmt.Errorf("unexpected %q at offset %d", ch, i)
+		}
+	}
+	return toks, nil
+}
+
+// ruleParser is a recursive-descent parser:
+//
+//	or      = and { "or" and }
+//	and     = not { "and" not }
+//	not     = "not" not | primary
+//	primary = "(" or ")" | ("blank" | "present") "(" column ")" | operand op operand
+//	column  = name | "[" text "]"
+type ruleParser struct {
+	s    *Schema
+	toks []ruleToken
+	pos  int
+	refs []int
+}
+
+func (p *ruleParser) peek() (ruleToken, bool) {
+	if p.pos >= len(p.toks) {
+		return ruleToken{}, false
+	}
+	return p.toks[p.pos], true
+}
+
+func (p *ruleParser) word(w string) bool {
+	t, ok := p.peek()
+	if ok && t.kind == tokIdent && !t.quoted && t.text == w {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *ruleParser) expect(kind int, text string) error {
+	t, ok := p.peek()
+	if !ok {
+		return fmt.Errorf("expected %q at end of expression", text)
+	}
+	if t.kind != kind {
+		return fmt.Errorf("expected %q, found %q", text, t.text)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *ruleParser) parseOr() (ruleExpr, error) {
+	l, err := p.parseAnd()
+	for err == nil && p.word("or") {
+		var r ruleExpr
+		r, err = p.parseAnd()
+		l = orExpr{l, r}
+	}
+	return l, err
+}
+
+func (p *ruleParser) parseAnd() (ruleExpr, error) {
+	l, err := p.parseNot()
+	for err == nil && p.word("and") {
+		var r ruleExpr
+		r, err = p.parseNot()
+		l = andExpr{l, r}
+	}
+	return l, err
+}
+
+func (p *ruleParser) parseNot() (ruleExpr, error) {
+	if p.word("not") {
+		x, err := p.parseNot()
+		return notExpr{x}, err
+	}
+	return p.parsePrimary()
+}
+
+func (p *ruleParser) parsePrimary() (ruleExpr, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	if t.kind == tokLParen {
+		p.pos++
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expect(tokRParen, ")")
+	}
+	if t.kind == tokIdent && !t.quoted && (t.text == "blank" || t.text == "present") &&
+		p.pos+1 < len(p.toks) && p.toks[p.pos+1].kind == tokLParen {
+		p.pos += 2
+		o, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if o.col < 0 {
+			return nil, fmt.Errorf("%s() takes a column", t.text)
+		}
+		return blankExpr{col: o.col, present: t.text == "present"}, p.expect(tokRParen, ")")
+	}
+
+	l, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.peek()
+	if !ok || op.kind != tokOp {
+		return nil, fmt.Errorf("expected comparison after %q", t.text)
+	}
+	p.pos++
+	r, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return comparison(l, op.text, r)
+}
+
+func (p *ruleParser) parseOperand() (ruleOperand, error) {
+	t, ok := p.peek()
+	if !ok {
+		return ruleOperand{}, fmt.Errorf("unexpected end of expression")
+	}
+	switch t.kind {
+	case tokString, tokNumber:
+		p.pos++
+		return ruleOperand{col: -1, tok: t}, nil
+	case tokIdent:
+		p.pos++
+		if !t.quoted && (t.text == "true" || t.text == "false") {
+			return ruleOperand{col: -1, tok: t}, nil
+		}
+		if !t.quoted && ruleKeywords[t.text] {
+			return ruleOperand{}, fmt.Errorf("%q is a keyword; write [%s] for a column of that name", t.text, t.text)
+		}
+		i := p.s.columnIndex(t.text)
+		if i < 0 {
+			return ruleOperand{}, fmt.Errorf("no such column %q", t.text)
+		}
+		seen := false
+		for _, j := range p.refs {
+			seen = seen || j == i
+		}
+		if !seen {
+			p.refs = append(p.refs, i)
+		}
+		return ruleOperand{col: i, c: p.s.Columns[i]}, nil
+	}
+	return ruleOperand{}, fmt.Errorf("unexpected %q", t.text)
+}
+
+// comparison type-checks l op r: at least one side must be a column, two
+// columns must have the same type (or both be numbers), and a literal must
+// be valid for the column's type.
+func comparison(l ruleOperand, op string, r ruleOperand) (ruleExpr, error) {
+	if l.col < 0 && r.col < 0 {
+		return nil, fmt.Errorf("comparison %q %s %q has no column", l.tok.text, op, r.tok.text)
+	}
+	if l.col < 0 {
+		l, r, op = r, l, mirroredOps[op]
+	}
+
+	kind := l.c.Type
+	if r.col >= 0 {
+		k := r.c.Type
+		switch {
+		case kind == k:
+		case isNumeric(kind) && isNumeric(k):
+			kind = "decimal"
+		default:
+			return nil, fmt.Errorf("cannot compare %s (%s) with %s (%s)", l.c.Name, l.c.Type, r.c.Name, r.c.Type)
+		}
+	} else {
+		v, err := ruleLiteral(l.c, r.tok)
+		if err != nil {
+			return nil, err
+		}
+		r.lit = v
+	}
+	if kind == "boolean" && op != "=" && op != "!=" {
+		return nil, fmt.Errorf("operator %s does not apply to boolean column %s", op, l.c.Name)
+	}
+	return cmpExpr{op: op, kind: kind, l: l, r: r}, nil
+}
+
+// mirroredOps maps op to the operator that keeps "a op b" true with the
+// sides swapped.
+var mirroredOps = map[string]string{"=": "=", "!=": "!=", "<": ">", "<=": ">=", ">": "<", ">=": "<="}
+
+func isNumeric(typ string) bool { return typ == "decimal" || typ == "integer" }
+
+// ruleLiteral converts a literal to the type of column c.
+func ruleLiteral(c Column, t ruleToken) (sortValue, error) {
+	v := sortValue{str: t.text}
+	bad := func() (sortValue, error) {
+		return sortValue{}, fmt.Errorf("invalid %s literal %q for column %s", c.Type, t.text, c.Name)
+	}
+	isBool := t.kind == tokIdent // true or false
+	if t.text == "" {
+		return sortValue{}, fmt.Errorf("empty literal for column %s (use blank())", c.Name)
+	}
+	switch c.Type {
+	case "decimal", "integer":
+		d, ok := parseDecimal(t.text)
+		if !ok || isBool {
+			return bad()
+		}
+		v.dec, v.typed = d, true
+	case "date":
+		tm, err := time.Parse("2006-01-02", t.text)
+		if err != nil || isBool {
+			return bad()
+		}
+		v.t, v.typed = tm, true
+	case "timestamp":
+		tm, err := time.Parse(time.RFC3339Nano, t.text)
+		if err != nil || isBool {
+			return bad()
+		}
+		v.t, v.typed = tm, true
+	case "boolean":
+		if t.text != "true" && t.text != "false" {
+			return bad()
+		}
+	default:
+		if isBool {
+			return bad()
+		}
+	}
+	return v, nil
+}
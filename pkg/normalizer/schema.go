@@ -0,0 +1,483 @@
+package normalizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Newline policies (Schema.Newlines).
+const (
+	NewlinesFail     = "fail"      // a line break in a field fails the file (default)
+	NewlinesRowError = "row_error" // the row gets ERR_NEWLINE and is left out
+)
+
+// Schema describes the expected columns of an input CSV, in output order.
+type Schema struct {
+	Columns []Column `json:"columns"`
+
+	// ExtraColumns says what to do with input columns the schema does not
+	// declare: "reject" (default), "drop" or "passthrough".
+	ExtraColumns string `json:"extra_columns,omitempty"`
+
+	// HeaderMatch is how input header names are compared with column names
+	// and aliases: "exact" (default, after trimming) or "normalized"
+	// (Unicode NFC, case-folded, inner whitespace collapsed).
+	HeaderMatch string `json:"header_match,omitempty"`
+
+	// Newlines is what a line break in a field without allow_newlines does:
+	// "fail" (default) fails the whole file, "row_error" reports
+	// ERR_NEWLINE and leaves the row out of normalized.csv.
+	Newlines string `json:"newlines,omitempty"`
+
+	// Preamble and Trailer describe non-data lines before the header and
+	// after the last row.
+	Preamble *Preamble `json:"preamble,omitempty"`
+	Trailer  *Trailer  `json:"trailer,omitempty"`
+
+	// PrimaryKey lists the (required) columns whose normalized values must
+	// be unique across rows, together (ERR_DUPLICATE_KEY otherwise).
+	PrimaryKey []string `json:"primary_key,omitempty"`
+
+	// SortBy orders normalized.csv by these columns (compared by type:
+	// dates and timestamps by instant, numbers by value), then by the whole
+	// record, so the output does not depend on input row order.
+	SortBy []SortKey `json:"sort_by,omitempty"`
+
+	// Dedupe drops repeated rows from normalized.csv and lists them in
+	// duplicates.csv: "off" (default), "exact" (whole normalized record) or
+	// "key" (primary_key).
+	Dedupe string `json:"dedupe,omitempty"`
+
+	// Rules are cross-field checks evaluated on each row after its columns
+	// are validated; see Rule.
+	Rules []Rule `json:"rules,omitempty"`
+
+	// ControlTotals are expected totals (row count, decimal sums) read from
+	// the trailer and reconciled after the scan.
+	ControlTotals *ControlTotals `json:"control_totals,omitempty"`
+
+	// Dialect describes the input's delimiter and quoting (default: RFC 4180
+	// comma-separated). Options.Dialect overrides it per run.
+	Dialect *Dialect `json:"dialect,omitempty"`
+
+	// Encoding is the input's character encoding (default "utf-8"); other
+	// encodings are transcoded to UTF-8 first. Options.Encoding overrides it.
+	Encoding string `json:"encoding,omitempty"`
+
+	raw []byte // bytes the schema was parsed from (for sha256_schema)
+}
+
+// Column is one schema column.
+type Column struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`     // "string" | "date" | "timestamp" | "decimal" | "integer" | "boolean"
+	Required bool   `json:"required"` // v0.1.0: required fields only
+
+	// Aliases are other header names accepted for this column. Output always
+	// uses Name.
+	Aliases []string `json:"aliases,omitempty"`
+
+	// OptionalInHeader lets the column be absent from the input header; its
+	// values are then blank. Cannot be combined with Required.
+	OptionalInHeader bool `json:"optional_in_header,omitempty"`
+
+	// string: keep line breaks inside values. They are written as LF inside
+	// a quoted field of normalized.csv. Without it a newline fails the file.
+	AllowNewlines bool `json:"allow_newlines,omitempty"`
+
+	// Unique requires non-blank normalized values to differ across rows
+	// (ERR_DUPLICATE_KEY otherwise).
+	Unique bool `json:"unique,omitempty"`
+
+	// string: closed set of allowed values (ERR_ENUM otherwise). Matches
+	// are written with the declared spelling.
+	Enum                []string `json:"enum,omitempty"`
+	EnumCaseInsensitive bool     `json:"enum_case_insensitive,omitempty"`
+
+	// string: RE2 pattern the whole value must match (ERR_PATTERN) and
+	// length bounds in characters (ERR_LENGTH).
+	Pattern   string `json:"pattern,omitempty"`
+	MinLength *int   `json:"min_length,omitempty"`
+	MaxLength *int   `json:"max_length,omitempty"`
+
+	// decimal/integer: inclusive bounds, compared exactly (ERR_RANGE).
+	Min string `json:"min,omitempty"`
+	Max string `json:"max,omitempty"`
+
+	// date/timestamp: accepted input layouts in Go reference-time notation.
+	// Dates default to "2006-01-02" only; timestamps to RFC 3339 with a 'T'
+	// or space separator, with or without a zone. output_format is the date
+	// output layout (default "2006-01-02").
+	Formats      []string `json:"formats,omitempty"`
+	OutputFormat string   `json:"output_format,omitempty"`
+
+	// timestamp: IANA zone for values without an offset (resolved from the
+	// embedded tz database), and fractional-second digits kept in the UTC
+	// output (default 0). Extra digits are rejected unless rounding is
+	// "truncate".
+	SourceTimezone string `json:"source_timezone,omitempty"`
+	Precision      *int   `json:"precision,omitempty"`
+
+	// date: inclusive YYYY-MM-DD bounds (ERR_RANGE).
+	MinDate string `json:"min_date,omitempty"`
+	MaxDate string `json:"max_date,omitempty"`
+
+	// decimal: output scale (default 2) and how extra digits are handled
+	// (default "truncate"; see the Round* constants). Timestamps accept
+	// "reject" (default) or "truncate" for sub-precision digits.
+	Scale    *int   `json:"scale,omitempty"`
+	Rounding string `json:"rounding,omitempty"`
+
+	// boolean: accepted tokens (case-insensitive). Defaults to
+	// true/t/yes/y/1 and false/f/no/n/0.
+	TrueValues  []string `json:"true_values,omitempty"`
+	FalseValues []string `json:"false_values,omitempty"`
+}
+
+// LoadSchema reads and validates the schema at path. It also returns the raw
+// schema bytes, whose digest is recorded in report.json.
+func LoadSchema(path string) (*Schema, []byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	s, err := ParseSchema(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, b, nil
+}
+
+// ParseSchema parses and validates a JSON schema document.
+func ParseSchema(b []byte) (*Schema, error) {
+	var s Schema
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("schema parse: %w", err)
+	}
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	s.raw = append([]byte(nil), b...)
+	return &s, nil
+}
+
+func (s *Schema) validate() error {
+	if len(s.Columns) == 0 {
+		return fmt.Errorf("schema: columns must be non-empty")
+	}
+	switch s.ExtraColumns {
+	case "", ExtraReject, ExtraDrop, ExtraPassthrough:
+	default:
+		return fmt.Errorf("schema: invalid extra_columns %q", s.ExtraColumns)
+	}
+	switch s.HeaderMatch {
+	case "", HeaderExact, HeaderNormalized:
+	default:
+		return fmt.Errorf("schema: invalid header_match %q", s.HeaderMatch)
+	}
+	switch s.Newlines {
+	case "", NewlinesFail, NewlinesRowError:
+	default:
+		return fmt.Errorf("schema: invalid newlines %q", s.Newlines)
+	}
+	if s.Preamble != nil {
+		if err := s.Preamble.validate(); err != nil {
+			return err
+		}
+	}
+	if s.Trailer != nil {
+		if err := s.Trailer.validate(); err != nil {
+			return err
+		}
+	}
+	if err := s.validateKeys(); err != nil {
+		return err
+	}
+	if err := s.validateSortBy(); err != nil {
+		return err
+	}
+	if err := s.validateDedupe(); err != nil {
+		return err
+	}
+	if err := s.validateControlTotals(); err != nil {
+		return err
+	}
+	if !validEncoding(s.Encoding) {
+		return fmt.Errorf("schema: invalid encoding %q", s.Encoding)
+	}
+	if s.Dialect != nil {
+		if err := s.Dialect.validate(); err != nil {
+			return fmt.Errorf("schema: %w", err)
+		}
+	}
+	seen := make(map[string]bool, len(s.Columns))
+	for i := range s.Columns {
+		if s.Columns[i].Name == "" {
+			return fmt.Errorf("schema: column[%d] name is empty", i)
+		}
+		if seen[s.headerKey(s.Columns[i].Name)] {
+			return fmt.Errorf("schema: duplicate column name %q", s.Columns[i].Name)
+		}
+		seen[s.headerKey(s.Columns[i].Name)] = true
+	}
+	// Aliases share the column-name namespace: each header name must resolve
+	// to at most one column.
+	for i := range s.Columns {
+		for _, a := range s.Columns[i].Aliases {
+			if a == "" || strings.TrimSpace(a) != a {
+				return fmt.Errorf("schema: column[%s]: alias %q must be non-empty and trimmed", s.Columns[i].Name, a)
+			}
+			if seen[s.headerKey(a)] {
+				return fmt.Errorf("schema: duplicate column name or alias %q", a)
+			}
+			seen[s.headerKey(a)] = true
+		}
+	}
+	for i := range s.Columns {
+		switch s.Columns[i].Type {
+		case "string", "date", "timestamp", "decimal", "integer", "boolean":
+		default:
+			return fmt.Errorf("schema: column[%s] has invalid type %q", s.Columns[i].Name, s.Columns[i].Type)
+		}
+		if s.Columns[i].Required && s.Columns[i].OptionalInHeader {
+			return fmt.Errorf("schema: column[%s]: required and optional_in_header are exclusive", s.Columns[i].Name)
+		}
+		if s.Columns[i].AllowNewlines && s.Columns[i].Type != "string" {
+			return fmt.Errorf("schema: column[%s]: allow_newlines requires type string", s.Columns[i].Name)
+		}
+		if err := s.Columns[i].validateEnum(); err != nil {
+			return err
+		}
+		if err := s.Columns[i].validateConstraints(); err != nil {
+			return err
+		}
+		if err := s.Columns[i].validateDateFormats(); err != nil {
+			return err
+		}
+		if err := s.Columns[i].validateTimestamp(); err != nil {
+			return err
+		}
+		if err := s.Columns[i].validateDecimal(); err != nil {
+			return err
+		}
+		if err := s.Columns[i].validateBoolean(); err != nil {
+			return err
+		}
+	}
+	// Rules are type-checked against the (now valid) columns.
+	return s.validateRules()
+}
+
+func (c Column) validateEnum() error {
+	if c.Type != "string" {
+		if len(c.Enum) > 0 || c.EnumCaseInsensitive {
+			return fmt.Errorf("schema: column[%s]: enum requires type \"string\"", c.Name)
+		}
+		return nil
+	}
+	if c.EnumCaseInsensitive && len(c.Enum) == 0 {
+		return fmt.Errorf("schema: column[%s]: enum_case_insensitive without enum", c.Name)
+	}
+	seen := make(map[string]string, len(c.Enum))
+	for _, e := range c.Enum {
+		if e == "" || strings.TrimSpace(e) != e {
+			return fmt.Errorf("schema: column[%s]: enum value %q must be non-empty and trimmed", c.Name, e)
+		}
+		if prev, ok := seen[c.enumKey(e)]; ok {
+			return fmt.Errorf("schema: column[%s]: enum values %q and %q collide", c.Name, prev, e)
+		}
+		seen[c.enumKey(e)] = e
+	}
+	return nil
+}
+
+func (c Column) validateConstraints() error {
+	if c.Type != "string" && (c.Pattern != "" || c.MinLength != nil || c.MaxLength != nil) {
+		return fmt.Errorf("schema: column[%s]: pattern/min_length/max_length require type \"string\"", c.Name)
+	}
+	if c.Type != "decimal" && c.Type != "integer" && (c.Min != "" || c.Max != "") {
+		return fmt.Errorf("schema: column[%s]: min/max require type \"decimal\" or \"integer\"", c.Name)
+	}
+	if c.Type != "date" && (c.MinDate != "" || c.MaxDate != "") {
+		return fmt.Errorf("schema: column[%s]: min_date/max_date require type \"date\"", c.Name)
+	}
+
+	if c.Pattern != "" {
+		if _, err := regexp.Compile(anchorPattern(c.Pattern)); err != nil {
+			return fmt.Errorf("schema: column[%s]: invalid pattern: %w", c.Name, err)
+		}
+	}
+	if (c.MinLength != nil && *c.MinLength < 0) || (c.MaxLength != nil && *c.MaxLength < 0) {
+		return fmt.Errorf("schema: column[%s]: min_length/max_length must be >= 0", c.Name)
+	}
+	if c.MinLength != nil && c.MaxLength != nil && *c.MinLength > *c.MaxLength {
+		return fmt.Errorf("schema: column[%s]: min_length %d > max_length %d", c.Name, *c.MinLength, *c.MaxLength)
+	}
+
+	var min, max decimal
+	var ok bool
+	if c.Min != "" {
+		if min, ok = parseDecimal(c.Min); !ok {
+			return fmt.Errorf("schema: column[%s]: invalid min %q", c.Name, c.Min)
+		}
+	}
+	if c.Max != "" {
+		if max, ok = parseDecimal(c.Max); !ok {
+			return fmt.Errorf("schema: column[%s]: invalid max %q", c.Name, c.Max)
+		}
+	}
+	if c.Min != "" && c.Max != "" && min.cmp(max) > 0 {
+		return fmt.Errorf("schema: column[%s]: min %s > max %s", c.Name, c.Min, c.Max)
+	}
+
+	var minDate, maxDate time.Time
+	var err error
+	if c.MinDate != "" {
+		if minDate, err = time.Parse("2006-01-02", c.MinDate); err != nil {
+			return fmt.Errorf("schema: column[%s]: invalid min_date %q", c.Name, c.MinDate)
+		}
+	}
+	if c.MaxDate != "" {
+		if maxDate, err = time.Parse("2006-01-02", c.MaxDate); err != nil {
+			return fmt.Errorf("schema: column[%s]: invalid max_date %q", c.Name, c.MaxDate)
+		}
+	}
+	if c.MinDate != "" && c.MaxDate != "" && minDate.After(maxDate) {
+		return fmt.Errorf("schema: column[%s]: min_date %s > max_date %s", c.Name, c.MinDate, c.MaxDate)
+	}
+	return nil
+}
+
+func (c Column) validateDateFormats() error {
+	if c.Type != "date" && c.OutputFormat != "" {
+		return fmt.Errorf("schema: column[%s]: output_format requires type \"date\"", c.Name)
+	}
+	if c.Type != "date" && c.Type != "timestamp" {
+		if len(c.Formats) > 0 {
+			return fmt.Errorf("schema: column[%s]: formats require type \"date\" or \"timestamp\"", c.Name)
+		}
+		return nil
+	}
+	isLayout := isDateLayout
+	if c.Type == "timestamp" {
+		isLayout = isTimestampLayout
+	}
+	seen := make(map[string]bool, len(c.Formats))
+	for _, f := range c.Formats {
+		if !isLayout(f) {
+			return fmt.Errorf("schema: column[%s]: invalid date format %q", c.Name, f)
+		}
+		if seen[f] {
+			return fmt.Errorf("schema: column[%s]: duplicate date format %q", c.Name, f)
+		}
+		seen[f] = true
+	}
+	if c.OutputFormat != "" && !isDateLayout(c.OutputFormat) {
+		return fmt.Errorf("schema: column[%s]: invalid output_format %q", c.Name, c.OutputFormat)
+	}
+	return nil
+}
+
+// isDateLayout reports whether layout round-trips a date, i.e. it carries a
+// year, month and day.
+func isDateLayout(layout string) bool {
+	ref := time.Date(2001, time.February, 3, 0, 0, 0, 0, time.UTC)
+	t, err := time.Parse(layout, ref.Format(layout))
+	return err == nil && t.Equal(ref)
+}
+
+// isTimestampLayout reports whether layout round-trips a date and a time
+// of day to the second.
+func isTimestampLayout(layout string) bool {
+	ref := time.Date(2001, time.February, 3, 4, 5, 6, 0, time.UTC)
+	t, err := time.Parse(layout, ref.Format(layout))
+	return err == nil && t.Equal(ref)
+}
+
+func (c Column) validateTimestamp() error {
+	if c.Type != "timestamp" {
+		if c.SourceTimezone != "" || c.Precision != nil {
+			return fmt.Errorf("schema: column[%s]: source_timezone/precision require type \"timestamp\"", c.Name)
+		}
+		return nil
+	}
+	if c.SourceTimezone != "" {
+		if _, err := loadZone(c.SourceTimezone); err != nil {
+			return fmt.Errorf("schema: column[%s]: source_timezone: %w", c.Name, err)
+		}
+	}
+	if c.Precision != nil && (*c.Precision < 0 || *c.Precision > 9) {
+		return fmt.Errorf("schema: column[%s]: precision must be between 0 and 9", c.Name)
+	}
+	switch c.Rounding {
+	case "", RoundReject, RoundTruncate:
+	default:
+		return fmt.Errorf("schema: column[%s]: timestamp rounding must be \"reject\" or \"truncate\"", c.Name)
+	}
+	return nil
+}
+
+// maxScale bounds decimal scales to something a ledger could plausibly need.
+const maxScale = 30
+
+func (c Column) validateDecimal() error {
+	if c.Type != "decimal" {
+		if c.Scale != nil || (c.Rounding != "" && c.Type != "timestamp") {
+			return fmt.Errorf("schema: column[%s]: scale/rounding require type \"decimal\"", c.Name)
+		}
+		return nil
+	}
+	if c.Scale != nil && (*c.Scale < 0 || *c.Scale > maxScale) {
+		return fmt.Errorf("schema: column[%s]: scale must be between 0 and %d", c.Name, maxScale)
+	}
+	switch c.Rounding {
+	case "", RoundReject, RoundTruncate, RoundHalfUp, RoundHalfEven, RoundFloor, RoundCeiling:
+	default:
+		return fmt.Errorf("schema: column[%s] has invalid rounding %q", c.Name, c.Rounding)
+	}
+	return nil
+}
+
+func (c Column) validateBoolean() error {
+	if c.Type != "boolean" {
+		if len(c.TrueValues) > 0 || len(c.FalseValues) > 0 {
+			return fmt.Errorf("schema: column[%s]: true_values/false_values require type \"boolean\"", c.Name)
+		}
+		return nil
+	}
+	for _, t := range append(c.trueValues(), c.falseValues()...) {
+		if strings.TrimSpace(t) == "" {
+			return fmt.Errorf("schema: column[%s] has an empty boolean token", c.Name)
+		}
+	}
+	for _, t := range c.trueValues() {
+		if matchToken(c.falseValues(), t) {
+			return fmt.Errorf("schema: column[%s]: boolean token %q is both true and false", c.Name, t)
+		}
+	}
+	return nil
+}
+
+func (s *Schema) extraColumns() string {
+	if s.ExtraColumns != "" {
+		return s.ExtraColumns
+	}
+	return ExtraReject
+}
+
+// sha256 is the digest recorded as sha256_schema: the bytes the schema was
+// parsed from, or its JSON encoding if it was built in code.
+func (s *Schema) sha256() (string, error) {
+	if s.raw != nil {
+		return sha256Hex(s.raw), nil
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	return sha256Hex(b), nil
+}
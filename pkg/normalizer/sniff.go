@@ -0,0 +1,221 @@
+package normalizer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/unicode"
+)
+
+// DefaultSniffBytes is how much of the input Sniff inspects by default.
+const DefaultSniffBytes = 64 << 10
+
+// sniffDelimiters are the delimiters Sniff tries, in tie-break order.
+var sniffDelimiters = []string{",", ";", "\t", "|"}
+
+// SniffReport is what Sniff detects about an input's format. The delimiter
+// and quoting fields use the same values as Dialect.
+type SniffReport struct {
+	BytesSampled int      `json:"bytes_sampled"`
+	Truncated    bool     `json:"truncated"`    // input is longer than the sample
+	Encoding     string   `json:"encoding"`     // "utf-8", "utf-16le", "utf-16be" or "unknown"
+	BOM          string   `json:"bom"`          // "utf-8", "utf-16le", "utf-16be" or "none"
+	LineEndings  string   `json:"line_endings"` // "lf", "crlf", "cr", "mixed" or "none"
+	Delimiter    string   `json:"delimiter"`
+	Quoting      string   `json:"quoting"`
+	Comment      string   `json:"comment"` // "#" if lines start with it, else ""
+	Header       []string `json:"header"`
+	Columns      int      `json:"columns"`
+	RowsSampled  int      `json:"rows_sampled"` // complete data rows in the sample
+}
+
+// Sniff inspects the first n bytes of r (DefaultSniffBytes if n <= 0) and
+// reports its encoding, line endings and most likely dialect. Detection is
+// deterministic: the same bytes always give the same report. Nothing is
+// guessed silently; an encoding that is neither UTF-8 nor BOM-marked or
+// NUL-padded UTF-16 is reported as "unknown".
+func Sniff(r io.Reader, n int) (SniffReport, error) {
+	if n <= 0 {
+		n = DefaultSniffBytes
+	}
+	buf, err := io.ReadAll(io.LimitReader(r, int64(n)+1))
+	if err != nil {
+		return SniffReport{}, err
+	}
+	rep := SniffReport{Truncated: len(buf) > n}
+	if rep.Truncated {
+		buf = buf[:n]
+	}
+	rep.BytesSampled = len(buf)
+
+	text, err := sniffDecode(buf, rep.Truncated, &rep)
+	if err != nil {
+		return SniffReport{}, err
+	}
+	rep.LineEndings = lineEndings(text)
+
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	if rep.Truncated {
+		// Drop the last, possibly partial, line.
+		if i := strings.LastIndexByte(text, '\n'); i >= 0 {
+			text = text[:i+1]
+		}
+	}
+
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if strings.HasPrefix(line, "#") {
+			rep.Comment = "#"
+			break
+		}
+	}
+
+	rep.Delimiter, rep.Quoting = ",", QuotingStandard
+	var best [][]string
+	bestOK := -1
+	for _, delim := range sniffDelimiters {
+		recs, quoting := sniffParse(text, delim, rep.Comment)
+		if len(recs) == 0 || len(recs[0]) < 2 {
+			continue
+		}
+		ok := 0
+		for _, rec := range recs {
+			if len(rec) == len(recs[0]) {
+				ok++
+			}
+		}
+		if ok > bestOK || (ok == bestOK && len(recs[0]) > len(best[0])) {
+			best, bestOK = recs, ok
+			rep.Delimiter, rep.Quoting = delim, quoting
+		}
+	}
+	if best == nil {
+		best, rep.Quoting = sniffParse(text, rep.Delimiter, rep.Comment)
+	}
+	if len(best) > 0 {
+		rep.Header = best[0]
+		rep.Columns = len(best[0])
+		rep.RowsSampled = len(best) - 1
+	}
+	if rep.Header == nil {
+		rep.Header = []string{}
+	}
+	return rep, nil
+}
+
+// sniffDecode fills in the encoding and BOM of the sample and returns its
+// text (BOM removed).
+func sniffDecode(buf []byte, truncated bool, rep *SniffReport) (string, error) {
+	rep.BOM = "none"
+	var order unicode.Endianness
+	utf16 := true
+	switch {
+	case bytes.HasPrefix(buf, []byte{0xEF, 0xBB, 0xBF}):
+		rep.BOM, utf16 = "utf-8", false
+		buf = buf[3:]
+	case bytes.HasPrefix(buf, []byte{0xFF, 0xFE}):
+		rep.BOM, order = "utf-16le", unicode.LittleEndian
+		buf = buf[2:]
+	case bytes.HasPrefix(buf, []byte{0xFE, 0xFF}):
+		rep.BOM, order = "utf-16be", unicode.BigEndian
+		buf = buf[2:]
+	default:
+		order, utf16 = utf16Order(buf)
+	}
+
+	if utf16 {
+		rep.Encoding = "utf-16be"
+		if order == unicode.LittleEndian {
+			rep.Encoding = "utf-16le"
+		}
+		if len(buf)%2 == 1 {
+			buf = buf[:len(buf)-1]
+		}
+		out, err := unicode.UTF16(order, unicode.IgnoreBOM).NewDecoder().Bytes(buf)
+		return string(out), err
+	}
+
+	if truncated {
+		buf = buf[:utf8Cut(buf)]
+	}
+	rep.Encoding = "utf-8"
+	if !utf8.Valid(buf) {
+		rep.Encoding = "unknown"
+	}
+	return string(buf), nil
+}
+
+// utf16Order guesses the byte order of BOM-less UTF-16 from where the NUL
+// bytes of ASCII characters fall; ok is false if the sample does not look
+// like UTF-16.
+func utf16Order(buf []byte) (order unicode.Endianness, ok bool) {
+	var even, odd int
+	for i, b := range buf {
+		if b != 0 {
+			continue
+		}
+		if i%2 == 0 {
+			even++
+		} else {
+			odd++
+		}
+	}
+	pairs := len(buf) / 2
+	switch {
+	case odd*2 > pairs && even == 0:
+		return unicode.LittleEndian, true
+	case even*2 > pairs && odd == 0:
+		return unicode.BigEndian, true
+	}
+	return unicode.BigEndian, false
+}
+
+// lineEndings classifies the line terminators in s.
+func lineEndings(s string) string {
+	crlf := strings.Count(s, "\r\n")
+	cr := strings.Count(s, "\r") - crlf
+	lf := strings.Count(s, "\n") - crlf
+	kinds, name := 0, "none"
+	for _, k := range []struct {
+		n    int
+		name string
+	}{{lf, "lf"}, {crlf, "crlf"}, {cr, "cr"}} {
+		if k.n > 0 {
+			kinds++
+			name = k.name
+		}
+	}
+	if kinds > 1 {
+		return "mixed"
+	}
+	return name
+}
+
+// sniffParse splits LF-terminated text with delim, using standard quoting
+// if the text parses that way and no quoting otherwise. Blank and comment
+// lines are skipped, as when normalizing.
+func sniffParse(text, delim, comment string) ([][]string, string) {
+	d := Dialect{Delimiter: delim, Quoting: QuotingStandard, Comment: comment}
+	for {
+		var recs [][]string
+		rr := newRecordReader(strings.NewReader(text), d)
+		var err error
+		for {
+			var rec []string
+			rec, err = rr.Read()
+			if err != nil {
+				break
+			}
+			if !isBlankRecord(rec) {
+				recs = append(recs, append([]string(nil), rec...))
+			}
+		}
+		if errors.Is(err, io.EOF) || d.Quoting == QuotingNone {
+			return recs, d.Quoting
+		}
+		d.Quoting = QuotingNone
+	}
+}
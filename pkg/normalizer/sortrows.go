@@ -0,0 +1,384 @@
+package normalizer
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultSortMemory is the default memory budget, in bytes, for sorting
+// normalized rows in memory before spilling runs to disk (Options.SortMemory).
+const DefaultSortMemory = 64 << 20
+
+// Sort directions (SortKey.Direction).
+const (
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
+// SortKey is one column of Schema.SortBy.
+type SortKey struct {
+	Column    string `json:"column"`
+	Direction string `json:"direction,omitempty"` // "asc" (default) or "desc"
+}
+
+func (s *Schema) validateSortBy() error {
+	seen := map[string]bool{}
+	for _, k := range s.SortBy {
+		if s.columnIndex(k.Column) < 0 {
+			return fmt.Errorf("schema: sort_by: no such column %q", k.Column)
+		}
+		if seen[k.Column] {
+			return fmt.Errorf("schema: sort_by: duplicate column %q", k.Column)
+		}
+		seen[k.Column] = true
+		switch k.Direction {
+		case "", SortAsc, SortDesc:
+		default:
+			return fmt.Errorf("schema: sort_by: invalid direction %q for column %q", k.Direction, k.Column)
+		}
+	}
+	return nil
+}
+
+// sortCol is a compiled SortKey.
+type sortCol struct {
+	idx  int // index into the normalized record
+	desc bool
+	c    Column
+}
+
+// sortValue is a normalized value prepared for comparison. Blank values
+// sort before all others (after them with "desc").
+type sortValue struct {
+	blank bool
+	typed bool // dec or t is set; otherwise compare str
+	dec   decimal
+	t     time.Time
+	str   string
+}
+
+func (sc sortCol) value(out string) sortValue {
+	v := sortValue{blank: out == "", str: out}
+	if v.blank {
+		return v
+	}
+	switch sc.c.Type {
+	case "decimal", "integer":
+		v.dec, v.typed = parseDecimal(out)
+	case "date":
+		t, err := time.Parse(sc.c.outputFormat(), out)
+		v.t, v.typed = t, err == nil
+	case "timestamp":
+		t, err := time.Parse(time.RFC3339Nano, out)
+		v.t, v.typed = t, err == nil
+	}
+	return v
+}
+
+func compareSortValues(kind string, a, b sortValue) int {
+	switch {
+	case a.blank || b.blank:
+		return boolCmp(!a.blank, !b.blank)
+	case a.typed && b.typed && (kind == "decimal" || kind == "integer"):
+		return a.dec.cmp(b.dec)
+	case a.typed && b.typed:
+		return a.t.Compare(b.t)
+	}
+	return strings.Compare(a.str, b.str)
+}
+
+func boolCmp(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case !a:
+		return -1
+	}
+	return 1
+}
+
+// sortItem is a normalized record with its sort values.
+type sortItem struct {
+	rec  []string
+	keys []sortValue
+}
+
+// rowSorter orders normalized records by the schema's sort_by columns, with
+// ties broken by the whole record, so the order is total and does not
+// depend on input order. Records are sorted in memory up to a budget, then
+// written to sorted run files and merged at the end, at most mergeFanIn
+// runs at a time.
+type rowSorter struct {
+	cols  []sortCol
+	limit int
+	dir   string
+	buf   []sortItem
+	used  int
+	runs  []string // run file names, oldest first
+}
+
+// mergeFanIn is the most runs merged (and files open) at once; with more
+// runs than that, they are first merged into fewer, longer runs.
+const mergeFanIn = 64
+
+// mergeCheckEvery is how many records a merge writes between checks for
+// cancellation.
+const mergeCheckEvery = 1024
+
+func newRowSorter(s *Schema, spec runSpec) *rowSorter {
+	rs := &rowSorter{limit: spec.sortMemory, dir: spec.tempDir}
+	if rs.limit <= 0 {
+		rs.limit = DefaultSortMemory
+	}
+	for _, k := range s.SortBy {
+		i := s.columnIndex(k.Column)
+		rs.cols = append(rs.cols, sortCol{idx: i, desc: k.Direction == SortDesc, c: s.Columns[i]})
+	}
+	return rs
+}
+
+func (rs *rowSorter) item(rec []string) sortItem {
+	it := sortItem{rec: rec, keys: make([]sortValue, len(rs.cols))}
+	for i, sc := range rs.cols {
+		it.keys[i] = sc.value(rec[sc.idx])
+	}
+	return it
+}
+
+func (rs *rowSorter) compare(a, b sortItem) int {
+	for i, sc := range rs.cols {
+		if c := compareSortValues(sc.c.Type, a.keys[i], b.keys[i]); c != 0 {
+			if sc.desc {
+				return -c
+			}
+			return c
+		}
+	}
+	for i := range a.rec {
+		if c := strings.Compare(a.rec[i], b.rec[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// add takes ownership of rec.
+func (rs *rowSorter) add(rec []string) error {
+	rs.buf = append(rs.buf, rs.item(rec))
+	rs.used += 64
+	for _, f := range rec {
+		rs.used += len(f) + 16
+	}
+	if rs.used >= rs.limit {
+		return rs.spill()
+	}
+	return nil
+}
+
+func (rs *rowSorter) sortBuf() {
+	sort.Slice(rs.buf, func(i, j int) bool { return rs.compare(rs.buf[i], rs.buf[j]) < 0 })
+}
+
+func (rs *rowSorter) spill() error {
+	rs.sortBuf()
+	err := rs.writeRun(func(put func([]string)) error {
+		for _, it := range rs.buf {
+			put(it.rec)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	rs.buf = rs.buf[:0]
+	rs.used = 0
+	return nil
+}
+
+// writeRun creates a run file and writes to it the records that fill passes
+// to put, which must already be sorted.
+func (rs *rowSorter) writeRun(fill func(put func([]string)) error) error {
+	f, err := os.CreateTemp(rs.dir, "normalizer-sort-*.run")
+	if err != nil {
+		return err
+	}
+	rs.runs = append(rs.runs, f.Name()) // so close removes it even if writing fails
+	w := bufio.NewWriter(f)
+	var tmp [binary.MaxVarintLen64]byte
+	err = fill(func(rec []string) {
+		w.Write(tmp[:binary.PutUvarint(tmp[:], uint64(len(rec)))])
+		for _, field := range rec {
+			w.Write(tmp[:binary.PutUvarint(tmp[:], uint64(len(field)))])
+			w.WriteString(field)
+		}
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// emit passes every record to fn in sorted order. Cancellation of ctx is
+// checked while runs are merged.
+func (rs *rowSorter) emit(ctx context.Context, fn func([]string) error) error {
+	rs.sortBuf()
+	if len(rs.runs) == 0 {
+		for _, it := range rs.buf {
+			if err := fn(it.rec); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Merge the oldest runs into one until the rest and the in-memory
+	// remainder fit in a single merge.
+	for len(rs.runs) >= mergeFanIn {
+		group := append([]string(nil), rs.runs[:mergeFanIn]...)
+		err := rs.writeRun(func(put func([]string)) error {
+			return rs.mergeFiles(ctx, group, nil, func(rec []string) error {
+				put(rec)
+				return nil
+			})
+		})
+		if err != nil {
+			return err
+		}
+		for _, name := range group {
+			os.Remove(name)
+		}
+		rs.runs = rs.runs[mergeFanIn:]
+	}
+	return rs.mergeFiles(ctx, rs.runs, &runSource{mem: rs.buf}, fn)
+}
+
+// mergeFiles opens the named runs and merges them, plus mem if non-nil, into
+// fn.
+func (rs *rowSorter) mergeFiles(ctx context.Context, names []string, mem *runSource, fn func([]string) error) error {
+	m := &sortMerge{rs: rs}
+	for _, name := range names {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := m.push(&runSource{r: bufio.NewReader(f)}); err != nil {
+			return err
+		}
+	}
+	if mem != nil {
+		if err := m.push(mem); err != nil {
+			return err
+		}
+	}
+	return m.merge(ctx, fn)
+}
+
+// close removes the run files.
+func (rs *rowSorter) close() {
+	for _, name := range rs.runs {
+		os.Remove(name)
+	}
+	rs.runs = nil
+}
+
+// runSource yields the records of one sorted run (a file or the in-memory
+// remainder).
+type runSource struct {
+	r    *bufio.Reader
+	mem  []sortItem
+	head sortItem
+}
+
+func (src *runSource) next(rs *rowSorter) (bool, error) {
+	if src.r == nil {
+		if len(src.mem) == 0 {
+			return false, nil
+		}
+		src.head, src.mem = src.mem[0], src.mem[1:]
+		return true, nil
+	}
+	n, err := binary.ReadUvarint(src.r)
+	if errors.Is(err, io.EOF) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	rec := make([]string, n)
+	for i := range rec {
+		l, err := binary.ReadUvarint(src.r)
+		if err != nil {
+			return false, err
+		}
+		b := make([]byte, l)
+		if _, err := io.ReadFull(src.r, b); err != nil {
+			return false, err
+		}
+		rec[i] = string(b)
+	}
+	src.head = rs.item(rec)
+	return true, nil
+}
+
+// sortMerge is a min-heap of run sources by their head record.
+type sortMerge struct {
+	rs   *rowSorter
+	srcs []*runSource
+}
+
+func (m *sortMerge) push(src *runSource) error {
+	ok, err := src.next(m.rs)
+	if err != nil || !ok {
+		return err
+	}
+	heap.Push(m, src)
+	return nil
+}
+
+// merge passes the records of every source to fn in sorted order.
+func (m *sortMerge) merge(ctx context.Context, fn func([]string) error) error {
+	for n := 0; m.Len() > 0; n++ {
+		if n%mergeCheckEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		src := m.srcs[0]
+		if err := fn(src.head.rec); err != nil {
+			return err
+		}
+		ok, err := src.next(m.rs)
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(m, 0)
+		} else {
+			heap.Pop(m)
+		}
+	}
+	return nil
+}
+
+func (m *sortMerge) Len() int           { return len(m.srcs) }
+func (m *sortMerge) Less(i, j int) bool { return m.rs.compare(m.srcs[i].head, m.srcs[j].head) < 0 }
+func (m *sortMerge) Swap(i, j int)      { m.srcs[i], m.srcs[j] = m.srcs[j], m.srcs[i] }
+func (m *sortMerge) Push(x any)         { m.srcs = append(m.srcs, x.(*runSource)) }
+func (m *sortMerge) Pop() any {
+	src := m.srcs[len(m.srcs)-1]
+	m.srcs = m.srcs[:len(m.srcs)-1]
+	return src
+}
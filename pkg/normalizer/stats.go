@@ -0,0 +1,128 @@
+package normalizer
+
+import (
+	"math/big"
+	"sort"
+	"time"
+)
+
+// colStats are the per-column counters of one run, reported under
+// "columns" in report.json. Errors count every rejected value; blanks,
+// distinct, min, max and sum describe normalized.csv, i.e. only rows that
+// were written (not rejected rows, nor rows dropped by dedupe). Distinct
+// values are counted exactly in a keyIndex, which spills to disk past its
+// memory budget, so memory stays bounded.
+type colStats struct {
+	blanks    int
+	errors    map[string]int // by code
+	distinct  *keyIndex      // normalized values seen so far
+	nDistinct int
+
+	// min/max in the column's own order (dates and timestamps by instant,
+	// numbers by value), kept with their normalized text.
+	minDec, maxDec   *decimal
+	minTime, maxTime time.Time
+	hasTime          bool
+	min, max         string
+
+	sum decimal // decimal: exact sum of the normalized values
+}
+
+func newColStats(c Column, spec runSpec) colStats {
+	st := colStats{errors: map[string]int{}, distinct: newKeyIndex(spec.keyMemory, spec.tempDir)}
+	if c.Type == "decimal" {
+		st.sum = decimal{unscaled: new(big.Int), scale: c.scale()}
+	}
+	return st
+}
+
+// written records the normalized value of column c in a row written to
+// normalized.csv. Min, max and sum are read back from the normalized text,
+// which is exact for every type.
+func (st *colStats) written(c *column, out string) error {
+	if out == "" {
+		st.blanks++
+		return nil
+	}
+	if err := st.addDistinct(out); err != nil {
+		return err
+	}
+	v := sortCol{c: c.Column}.value(out)
+	if !v.typed {
+		return nil
+	}
+	switch c.Type {
+	case "decimal":
+		st.sum = st.sum.add(v.dec)
+		st.seenDecimal(v.dec, out)
+	case "integer":
+		st.seenDecimal(v.dec, out)
+	case "date", "timestamp":
+		st.seenTime(v.t, out)
+	}
+	return nil
+}
+
+func (st *colStats) addDistinct(out string) error {
+	seen, err := st.distinct.lookup(out)
+	if err != nil || seen > 0 {
+		return err
+	}
+	st.nDistinct++
+	return st.distinct.insert(out, 1) // any non-zero row marks it seen
+}
+
+func (st *colStats) seenDecimal(d decimal, out string) {
+	if st.minDec == nil || d.cmp(*st.minDec) < 0 {
+		st.minDec, st.min = &d, out
+	}
+	if st.maxDec == nil || d.cmp(*st.maxDec) > 0 {
+		st.maxDec, st.max = &d, out
+	}
+}
+
+func (st *colStats) seenTime(t time.Time, out string) {
+	if !st.hasTime || t.Before(st.minTime) {
+		st.minTime, st.min = t, out
+	}
+	if !st.hasTime || t.After(st.maxTime) {
+		st.maxTime, st.max = t, out
+	}
+	st.hasTime = true
+}
+
+// report returns the statistics part of the column's report entry.
+func (st *colStats) report(c *column) ColumnReport {
+	cr := ColumnReport{
+		Name:     c.Name,
+		Blanks:   st.blanks,
+		Errors:   codeCounts(st.errors),
+		Distinct: st.nDistinct,
+		Min:      st.min,
+		Max:      st.max,
+	}
+	if c.Type == "decimal" {
+		cr.Sum = st.sum.String()
+	}
+	return cr
+}
+
+// closeColumns removes the spill files of the distinct-value indexes.
+func closeColumns(cols []column) {
+	for i := range cols {
+		cols[i].stats.distinct.close()
+	}
+}
+
+// codeCounts turns a code -> count map into a list sorted by code.
+func codeCounts(m map[string]int) []CodeCount {
+	if len(m) == 0 {
+		return nil
+	}
+	out := make([]CodeCount, 0, len(m))
+	for code, n := range m {
+		out = append(out, CodeCount{Code: code, Count: n})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Code < out[j].Code })
+	return out
+}
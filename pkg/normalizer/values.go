@@ -0,0 +1,416 @@
+package normalizer
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Default boolean tokens, matched case-insensitively.
+var (
+	defaultTrueValues  = []string{"true", "t", "yes", "y", "1"}
+	defaultFalseValues = []string{"false", "f", "no", "n", "0"}
+)
+
+// column is a schema Column with its lookups prepared for the row loop.
+type column struct {
+	Column
+	enum     map[string]string // match key -> declared spelling
+	pattern  *regexp.Regexp
+	min, max *decimal
+	minDate  *time.Time
+	maxDate  *time.Time
+
+	formatHits []int // per declared date format: values it parsed
+	stats      colStats
+
+	zone      *time.Location // timestamp source_timezone
+	tsFormats []string       // effective timestamp layouts
+	tsZoned   []bool         // whether each layout reads an offset
+}
+
+// compileColumns prepares the columns of an already validated schema.
+func compileColumns(s *Schema, spec runSpec) []column {
+	cols := make([]column, len(s.Columns))
+	for i, c := range s.Columns {
+		cols[i].Column = c
+		cols[i].stats = newColStats(c, spec)
+		if len(c.Enum) > 0 {
+			cols[i].enum = make(map[string]string, len(c.Enum))
+			for _, e := range c.Enum {
+				cols[i].enum[c.enumKey(e)] = e
+			}
+		}
+		if c.Pattern != "" {
+			cols[i].pattern = regexp.MustCompile(anchorPattern(c.Pattern))
+		}
+		if c.Min != "" {
+			d, _ := parseDecimal(c.Min)
+			cols[i].min = &d
+		}
+		if c.Max != "" {
+			d, _ := parseDecimal(c.Max)
+			cols[i].max = &d
+		}
+		if c.MinDate != "" {
+			t, _ := time.Parse("2006-01-02", c.MinDate)
+			cols[i].minDate = &t
+		}
+		if c.MaxDate != "" {
+			t, _ := time.Parse("2006-01-02", c.MaxDate)
+			cols[i].maxDate = &t
+		}
+		cols[i].formatHits = make([]int, len(c.Formats))
+		if c.Type == "timestamp" {
+			cols[i].zone, _ = loadZone(c.SourceTimezone)
+			cols[i].tsFormats = c.Formats
+			if len(c.Formats) == 0 {
+				cols[i].tsFormats = defaultTimestampFormats
+			}
+			for _, f := range cols[i].tsFormats {
+				cols[i].tsZoned = append(cols[i].tsZoned, layoutHasZone(f))
+			}
+		}
+	}
+	return cols
+}
+
+// anchorPattern makes a schema pattern match the whole value.
+func anchorPattern(p string) string {
+	return `^(?:` + p + `)$`
+}
+
+// normalizeValue returns the canonical form of the trimmed, non-blank value v
+// of column c, or a RowError (without Row/Field) saying why v was rejected.
+func normalizeValue(c *column, v string) (string, *RowError) {
+	switch c.Type {
+	case "string":
+		if n := utf8.RuneCountInString(v); c.MinLength != nil && n < *c.MinLength {
+			return "", &RowError{Code: "ERR_LENGTH", Message: fmt.Sprintf("shorter than min_length %d", *c.MinLength), Value: v}
+		} else if c.MaxLength != nil && n > *c.MaxLength {
+			return "", &RowError{Code: "ERR_LENGTH", Message: fmt.Sprintf("longer than max_length %d", *c.MaxLength), Value: v}
+		}
+		if c.pattern != nil && !c.pattern.MatchString(v) {
+			return "", &RowError{Code: "ERR_PATTERN", Message: "does not match pattern", Value: v}
+		}
+		if c.enum != nil {
+			e, ok := c.enum[c.enumKey(v)]
+			if !ok {
+				return "", &RowError{Code: "ERR_ENUM", Message: "value not in enum", Value: v}
+			}
+			return e, nil
+		}
+		return v, nil
+	case "date":
+		t, verr := c.parseDate(v)
+		if verr != nil {
+			return "", verr
+		}
+		if c.minDate != nil && t.Before(*c.minDate) {
+			return "", &RowError{Code: "ERR_RANGE", Message: "before min_date " + c.MinDate, Value: v}
+		}
+		if c.maxDate != nil && t.After(*c.maxDate) {
+			return "", &RowError{Code: "ERR_RANGE", Message: "after max_date " + c.MaxDate, Value: v}
+		}
+		return t.Format(c.outputFormat()), nil
+	case "timestamp":
+		t, verr := c.parseTimestamp(v)
+		if verr != nil {
+			return "", verr
+		}
+		return formatTimestamp(t, c.precision()), nil
+	case "decimal":
+		d, ok := parseDecimal(v)
+		if !ok {
+			return "", &RowError{Code: "ERR_DECIMAL", Message: "invalid decimal", Value: v}
+		}
+		d, _, ok = d.rescale(c.scale(), c.rounding())
+		if !ok {
+			return "", &RowError{Code: "ERR_SCALE", Message: fmt.Sprintf("more than %d decimal places", c.scale()), Value: v}
+		}
+		if verr := c.checkRange(d, v); verr != nil {
+			return "", verr
+		}
+		return d.String(), nil
+	case "integer":
+		out, ok := canonicalInteger(v)
+		if !ok {
+			return "", &RowError{Code: "ERR_INTEGER", Message: "invalid integer", Value: v}
+		}
+		if _, err := strconv.ParseInt(out, 10, 64); err != nil {
+			return "", &RowError{Code: "ERR_INTEGER_RANGE", Message: "integer out of range (64-bit signed)", Value: v}
+		}
+		d, _ := parseDecimal(out)
+		if verr := c.checkRange(d, v); verr != nil {
+			return "", verr
+		}
+		return out, nil
+	case "boolean":
+		if matchToken(c.trueValues(), v) {
+			return "true", nil
+		}
+		if matchToken(c.falseValues(), v) {
+			return "false", nil
+		}
+		return "", &RowError{Code: "ERR_BOOLEAN", Message: "invalid boolean", Value: v}
+	default:
+		return v, nil
+	}
+}
+
+// parseDate tries every declared format. A value that two formats read as
+// different dates is rejected as ambiguous rather than resolved by order.
+func (c *column) parseDate(v string) (time.Time, *RowError) {
+	if len(c.Formats) == 0 {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return time.Time{}, &RowError{Code: "ERR_DATE", Message: "invalid date (want YYYY-MM-DD)", Value: v}
+		}
+		return t, nil
+	}
+
+	matched := -1
+	var t time.Time
+	for i, layout := range c.Formats {
+		p, err := time.Parse(layout, v)
+		if err != nil {
+			continue
+		}
+		if matched < 0 {
+			matched, t = i, p
+			continue
+		}
+		if !p.Equal(t) {
+			return time.Time{}, &RowError{
+				Code:    "ERR_DATE_AMBIGUOUS",
+				Message: fmt.Sprintf("ambiguous date (formats %s and %s disagree)", c.Formats[matched], layout),
+				Value:   v,
+			}
+		}
+	}
+	if matched < 0 {
+		return time.Time{}, &RowError{
+			Code:    "ERR_DATE",
+			Message: "invalid date (want one of: " + strings.Join(c.Formats, ", ") + ")",
+			Value:   v,
+		}
+	}
+	c.formatHits[matched]++
+	return t, nil
+}
+
+// Default timestamp input layouts. time.Parse also accepts fractional
+// seconds after the seconds field, so these cover sub-second values too.
+var defaultTimestampFormats = []string{
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+}
+
+// parseTimestamp returns v as an instant. Values without an offset are read
+// in source_timezone; formats that disagree make the value ambiguous.
+func (c *column) parseTimestamp(v string) (time.Time, *RowError) {
+	formats := c.tsFormats
+	tsErr := func(msg string) (time.Time, *RowError) {
+		return time.Time{}, &RowError{Code: "ERR_TIMESTAMP", Message: msg, Value: v}
+	}
+
+	matched := -1
+	var t time.Time
+	for i, layout := range formats {
+		p, err := time.Parse(layout, v)
+		if err != nil {
+			continue
+		}
+		if !c.tsZoned[i] {
+			if c.zone == nil {
+				return tsErr("timestamp has no offset and column has no source_timezone")
+			}
+			var msg string
+			if p, msg = wallInZone(p, c.zone); msg != "" {
+				return tsErr(msg)
+			}
+		}
+		if matched < 0 {
+			matched, t = i, p
+			continue
+		}
+		if !p.Equal(t) {
+			return tsErr(fmt.Sprintf("ambiguous timestamp (formats %s and %s disagree)", formats[matched], layout))
+		}
+	}
+	if matched < 0 {
+		return tsErr("invalid timestamp")
+	}
+	if len(c.Formats) > 0 {
+		c.formatHits[matched]++
+	}
+
+	unit := time.Duration(1)
+	for i := c.precision(); i < 9; i++ {
+		unit *= 10
+	}
+	if t.Nanosecond()%int(unit) != 0 {
+		if c.Rounding != RoundTruncate {
+			return tsErr(fmt.Sprintf("more than %d fractional second digits", c.precision()))
+		}
+		t = t.Add(-time.Duration(t.Nanosecond() % int(unit)))
+	}
+	return t, nil
+}
+
+// layoutHasZone reports whether layout reads a zone offset.
+func layoutHasZone(layout string) bool {
+	ref := time.Date(2001, time.February, 3, 4, 5, 6, 0, time.FixedZone("", 3600))
+	t, err := time.Parse(layout, ref.Format(layout))
+	return err == nil && t.Equal(ref)
+}
+
+// formatTimestamp writes t as RFC 3339 in UTC with exactly precision
+// fractional digits.
+func formatTimestamp(t time.Time, precision int) string {
+	layout := "2006-01-02T15:04:05"
+	if precision > 0 {
+		layout += "." + strings.Repeat("0", precision)
+	}
+	return t.UTC().Format(layout + "Z")
+}
+
+func (c Column) precision() int {
+	if c.Precision != nil {
+		return *c.Precision
+	}
+	return 0
+}
+
+func (c Column) outputFormat() string {
+	if c.OutputFormat != "" {
+		return c.OutputFormat
+	}
+	return "2006-01-02"
+}
+
+// checkRange compares the canonical numeric value d against min/max exactly.
+func (c *column) checkRange(d decimal, v string) *RowError {
+	if c.min != nil && d.cmp(*c.min) < 0 {
+		return &RowError{Code: "ERR_RANGE", Message: "below min " + c.Min, Value: v}
+	}
+	if c.max != nil && d.cmp(*c.max) > 0 {
+		return &RowError{Code: "ERR_RANGE", Message: "above max " + c.Max, Value: v}
+	}
+	return nil
+}
+
+// canonicalInteger accepts an optional sign followed by ASCII digits and
+// returns it without '+' or leading zeros ("-0" becomes "0").
+func canonicalInteger(s string) (string, bool) {
+	neg := false
+	switch {
+	case strings.HasPrefix(s, "-"):
+		neg = true
+		s = s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+	if s == "" {
+		return "", false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return "", false
+		}
+	}
+	s = strings.TrimLeft(s, "0")
+	if s == "" {
+		return "0", true
+	}
+	if neg {
+		s = "-" + s
+	}
+	return s, true
+}
+
+// Decimal defaults (v0.1.0 behavior): 2 places, extra digits truncated.
+const (
+	defaultScale    = 2
+	defaultRounding = RoundTruncate
+)
+
+func (c Column) scale() int {
+	if c.Scale != nil {
+		return *c.Scale
+	}
+	return defaultScale
+}
+
+func (c Column) rounding() string {
+	if c.Rounding != "" {
+		return c.Rounding
+	}
+	return defaultRounding
+}
+
+// enumKey is the form enum values are matched on.
+func (c Column) enumKey(v string) string {
+	if c.EnumCaseInsensitive {
+		return strings.ToLower(v)
+	}
+	return v
+}
+
+func (c Column) trueValues() []string {
+	if len(c.TrueValues) > 0 {
+		return c.TrueValues
+	}
+	return defaultTrueValues
+}
+
+func (c Column) falseValues() []string {
+	if len(c.FalseValues) > 0 {
+		return c.FalseValues
+	}
+	return defaultFalseValues
+}
+
+func matchToken(tokens []string, v string) bool {
+	for _, t := range tokens {
+		if strings.EqualFold(t, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func looksDecimal(s string) bool {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return false
+	}
+	if s[0] == '-' {
+		s = s[1:]
+		if s == "" {
+			return false
+		}
+	}
+	dot := false
+	digits := 0
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if ch == '.' {
+			if dot {
+				return false
+			}
+			dot = true
+			continue
+		}
+		if ch < '0' || ch > '9' {
+			return false
+		}
+		digits++
+	}
+	return digits > 0
+}
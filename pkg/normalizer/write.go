@@ -0,0 +1,71 @@
+package normalizer
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// atomicFile streams into a temp file next to its final name; Commit renames
+// it into place, Abort removes it. Outputs are never left half-written.
+type atomicFile struct {
+	*os.File
+	tmp   string
+	final string
+}
+
+func createAtomic(dir, name string) (*atomicFile, error) {
+	tmp := filepath.Join(dir, fmt.Sprintf(".tmp.%s.%d", name, os.Getpid()))
+	f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &atomicFile{File: f, tmp: tmp, final: filepath.Join(dir, name)}, nil
+}
+
+func (f *atomicFile) Commit() error {
+	if err := f.Close(); err != nil {
+		_ = os.Remove(f.tmp)
+		return err
+	}
+	if err := os.Rename(f.tmp, f.final); err != nil {
+		// On Windows, Rename fails if the destination exists. Best-effort remove+retry.
+		_ = os.Remove(f.final)
+		if err2 := os.Rename(f.tmp, f.final); err2 != nil {
+			_ = os.Remove(f.tmp)
+			return err2
+		}
+	}
+	return nil
+}
+
+func (f *atomicFile) Abort() {
+	_ = f.Close()
+	_ = os.Remove(f.tmp)
+}
+
+// makeOutDir creates dir and any missing parents. undo removes the
+// directories it created, deepest first, for a run that fails before
+// committing; a directory that is no longer empty is left alone.
+func makeOutDir(dir string) (undo func(), err error) {
+	var created []string
+	for d := filepath.Clean(dir); ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); !errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		created = append(created, d)
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return func() {
+		for _, d := range created {
+			_ = os.Remove(d)
+		}
+	}, nil
+}
@@ -0,0 +1,104 @@
+package normalizer
+
+import (
+	"archive/zip"
+	"bytes"
+	_ "embed"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// zoneinfo.zip is the IANA time zone database as shipped in
+// $GOROOT/lib/time, and zoneinfo.version is its IANA release. Zones are
+// loaded from this copy only, never from the host, so timestamp
+// normalization gives the same answer on every machine. Both files are
+// refreshed together from the installed Go toolchain with "make tzdata"
+// (go generate); a refresh can change timestamp outputs.
+//
+//go:generate sh -c "cp \"$(go env GOROOT)/lib/time/zoneinfo.zip\" zoneinfo.zip && sed -n 's/^DATA=//p' \"$(go env GOROOT)/lib/time/update.bash\" > zoneinfo.version"
+//go:embed zoneinfo.zip
+var zoneinfoZip []byte
+
+//go:embed zoneinfo.version
+var zoneinfoVersion string
+
+// TZDataVersion is the IANA release of the embedded time zone database
+// (e.g. "2026c").
+func TZDataVersion() string {
+	return strings.TrimSpace(zoneinfoVersion)
+}
+
+var zoneCache sync.Map // name -> *time.Location
+
+// loadZone resolves an IANA zone name from the embedded database. An empty
+// name means no zone (nil).
+func loadZone(name string) (*time.Location, error) {
+	if name == "" {
+		return nil, nil
+	}
+	if name == "UTC" {
+		return time.UTC, nil
+	}
+	if loc, ok := zoneCache.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	zr, err := zip.NewReader(bytes.NewReader(zoneinfoZip), int64(len(zoneinfoZip)))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		loc, err := time.LoadLocationFromTZData(name, data)
+		if err != nil {
+			return nil, err
+		}
+		zoneCache.Store(name, loc)
+		return loc, nil
+	}
+	return nil, fmt.Errorf("unknown time zone %q", name)
+}
+
+// wallInZone reads the wall clock of t (parsed without a zone, so in UTC) as
+// a local time in loc. Local times skipped or repeated by a DST transition
+// are reported instead of being resolved silently.
+func wallInZone(t time.Time, loc *time.Location) (time.Time, string) {
+	var found []time.Time
+	for _, probe := range []time.Duration{-48 * time.Hour, 0, 48 * time.Hour} {
+		_, off := t.Add(probe).In(loc).Zone()
+		cand := t.Add(-time.Duration(off) * time.Second)
+		w := cand.In(loc)
+		wall := time.Date(w.Year(), w.Month(), w.Day(), w.Hour(), w.Minute(), w.Second(), w.Nanosecond(), time.UTC)
+		if !wall.Equal(t) {
+			continue
+		}
+		dup := false
+		for _, f := range found {
+			dup = dup || f.Equal(cand)
+		}
+		if !dup {
+			found = append(found, cand)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return time.Time{}, "local time does not exist in " + loc.String()
+	case 1:
+		return found[0], ""
+	default:
+		return time.Time{}, "local time is ambiguous in " + loc.String()
+	}
+}
@@ -0,0 +1,67 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nicholaskarlson/proof-first-normalizer/pkg/normalizer"
+)
+
+func TestGoldenCase01Reader(t *testing.T) {
+	root := projectRoot(t)
+
+	raw, err := os.ReadFile(filepath.Join(root, "fixtures", "input", "case01", "raw.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, _, err := normalizer.LoadSchema(filepath.Join(root, "fixtures", "input", "case01", "schema.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expDir := filepath.Join(root, "fixtures", "expected", "case01")
+
+	opt := normalizer.Options{
+		Tool:    "proof-first-normalizer",
+		Version: "dev",
+		Label:   "case01",
+		Schema:  "fixtures/input/case01/schema.json",
+		Input:   "fixtures/input/case01/raw.csv",
+	}
+
+	var norm, errs, rep bytes.Buffer
+	out := normalizer.Outputs{Normalized: &norm, Errors: &errs, Report: &rep}
+	if _, err := normalizer.Normalize(context.Background(), bytes.NewReader(raw), schema, out, opt); err != nil {
+		t.Fatalf("normalize: %v", err)
+	}
+
+	assertBytesEqual(t, filepath.Join(expDir, "normalized.csv"), norm.Bytes())
+	assertBytesEqual(t, filepath.Join(expDir, "errors.csv"), errs.Bytes())
+	assertBytesEqual(t, filepath.Join(expDir, "report.json"), rep.Bytes())
+
+	// A cancelled context stops the run before any report is written.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rep.Reset()
+	_, err = normalizer.Normalize(ctx, bytes.NewReader(raw), schema, normalizer.Outputs{Report: &rep}, opt)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if rep.Len() != 0 {
+		t.Fatalf("expected no report after cancellation")
+	}
+}
+
+func assertBytesEqual(t *testing.T, want string, got []byte) {
+	t.Helper()
+	wb, err := os.ReadFile(want)
+	if err != nil {
+		t.Fatalf("read %s: %v", want, err)
+	}
+	if !bytes.Equal(wb, got) {
+		t.Fatalf("output differs from %s:\n%s", want, got)
+	}
+}
@@ -5,7 +5,7 @@ import (
 	"path/filepath"
 	"testing"
 
-	"github.com/nicholaskarlson/proof-first-normalizer/internal/normalizer"
+	"github.com/nicholaskarlson/proof-first-normalizer/pkg/normalizer"
 )
 
 func TestGoldenCase01(t *testing.T) {
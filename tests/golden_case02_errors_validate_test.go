@@ -0,0 +1,51 @@
+package tests
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/nicholaskarlson/proof-first-normalizer/pkg/normalizer"
+)
+
+func TestGoldenCase02ErrorsValidate(t *testing.T) {
+	root := projectRoot(t)
+
+	inCSV := filepath.Join(root, "fixtures", "input", "case02_errors", "raw.csv")
+	schemaFile := filepath.Join(root, "fixtures", "input", "case02_errors", "schema.json")
+	expDir := filepath.Join(root, "fixtures", "expected", "case02_errors")
+
+	res, errs, err := normalizer.ValidateCSV(inCSV, schemaFile, normalizer.Options{Label: "case02_errors"})
+	if err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if res.RowsError != 5 {
+		t.Fatalf("expected 5 error rows, got %d", res.RowsError)
+	}
+
+	// ValidateCSV must return exactly the rows NormalizeCSV writes to errors.csv.
+	f, err := os.Open(filepath.Join(expDir, "errors.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	want, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = want[1:] // header
+
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors, got %d", len(want), len(errs))
+	}
+	for i, e := range errs {
+		got := []string{strconv.Itoa(e.Row), e.Field, e.Code, e.Message, e.Value}
+		for j := range got {
+			if got[j] != want[i][j] {
+				t.Fatalf("error %d: got %v, want %v", i, got, want[i])
+			}
+		}
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"path/filepath"
 	"testing"
 
-	"github.com/nicholaskarlson/proof-first-normalizer/internal/normalizer"
+	"github.com/nicholaskarlson/proof-first-normalizer/pkg/normalizer"
 )
 
 func TestGoldenCase03BOMCRLF(t *testing.T) {
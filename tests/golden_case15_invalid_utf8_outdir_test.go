@@ -0,0 +1,29 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nicholaskarlson/proof-first-normalizer/pkg/normalizer"
+)
+
+// A run that fails on its input must not leave behind the out dir (or the
+// parents) it created.
+func TestGoldenCase15InvalidUTF8OutDir(t *testing.T) {
+	root := projectRoot(t)
+
+	caseName := "case15_invalid_utf8"
+	inCSV := filepath.Join(root, "fixtures", "input", caseName, "raw.csv")
+	schemaFile := filepath.Join(root, "fixtures", "input", caseName, "schema.json")
+
+	base := t.TempDir()
+	outDir := filepath.Join(base, "out", caseName)
+
+	if _, err := normalizer.NormalizeCSV(inCSV, schemaFile, outDir, normalizer.Options{Label: caseName}); err == nil {
+		t.Fatalf("expected error, got success")
+	}
+	if _, err := os.Stat(filepath.Join(base, "out")); !os.IsNotExist(err) {
+		t.Fatalf("expected %s not to exist, stat: %v", filepath.Join(base, "out"), err)
+	}
+}
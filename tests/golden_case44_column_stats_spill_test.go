@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nicholaskarlson/proof-first-normalizer/pkg/normalizer"
+)
+
+// With a tiny key memory budget every distinct value spills to its own run
+// file; the counts in report.json must not change, and the run files must
+// be cleaned up.
+func TestGoldenCase44ColumnStatsSpill(t *testing.T) {
+	root := projectRoot(t)
+
+	for _, c := range []string{"case44_column_stats", "case65_column_stats_written_rows"} {
+		t.Run(c, func(t *testing.T) {
+			raw, err := os.ReadFile(filepath.Join(root, "fixtures", "input", c, "raw.csv"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			schema, _, err := normalizer.LoadSchema(filepath.Join(root, "fixtures", "input", c, "schema.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			expDir := filepath.Join(root, "fixtures", "expected", c)
+			tmp := t.TempDir()
+
+			opt := normalizer.Options{
+				Tool:      "proof-first-normalizer",
+				Version:   "dev",
+				Label:     c,
+				Schema:    "fixtures/input/" + c + "/schema.json",
+				Input:     "fixtures/input/" + c + "/raw.csv",
+				KeyMemory: 1,
+				TempDir:   tmp,
+			}
+
+			var norm, errs, rep bytes.Buffer
+			out := normalizer.Outputs{Normalized: &norm, Errors: &errs, Report: &rep}
+			if _, err := normalizer.Normalize(context.Background(), bytes.NewReader(raw), schema, out, opt); err != nil {
+				t.Fatalf("normalize: %v", err)
+			}
+
+			assertBytesEqual(t, filepath.Join(expDir, "normalized.csv"), norm.Bytes())
+			assertBytesEqual(t, filepath.Join(expDir, "errors.csv"), errs.Bytes())
+			assertBytesEqual(t, filepath.Join(expDir, "report.json"), rep.Bytes())
+
+			left, err := os.ReadDir(tmp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(left) != 0 {
+				t.Fatalf("expected spill files to be removed, found %d", len(left))
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package tests
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nicholaskarlson/proof-first-normalizer/pkg/normalizer"
+)
+
+func TestGoldenSniff(t *testing.T) {
+	root := projectRoot(t)
+
+	for _, c := range []string{
+		"case01",
+		"case03_bom_crlf",
+		"case15_invalid_utf8",
+		"case30_dialect_semicolon",
+		"case31_dialect_tsv_unquoted",
+		"case34_encoding_utf16le_bom",
+	} {
+		t.Run(c, func(t *testing.T) {
+			f, err := os.Open(filepath.Join(root, "fixtures", "input", c, "raw.csv"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			rep, err := normalizer.Sniff(f, normalizer.DefaultSniffBytes)
+			if err != nil {
+				t.Fatalf("sniff: %v", err)
+			}
+			got, err := json.MarshalIndent(rep, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertBytesEqual(t, filepath.Join(root, "fixtures", "expected", c, "sniff.json"), append(got, '\n'))
+		})
+	}
+}